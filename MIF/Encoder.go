@@ -0,0 +1,124 @@
+package MIF
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Encoder writes words as a MIF file, the inverse of what a Parser does.
+type Encoder struct {
+	w          io.Writer
+	Width      int64  // bits per word, between 1 and 64
+	Depth      int64  // number of words, missing ones are written as zero
+	AddrFormat Format // the ADDRESS_RADIX
+	DataFormat Format // the DATA_RADIX
+}
+
+// NewEncoder creates an encoder with the layout of the ICMC code MIFs: 16 bit
+// words, unsigned addresses and binary data. The depth must still be set.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, Width: 16, AddrFormat: FormatUnsiged, DataFormat: FormatBin}
+}
+
+// formatName returns the identifier used in a MIF for a Format.
+func formatName(f Format) (string, bool) {
+	for name, v := range formatMap {
+		if v == f {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Encode writes a complete MIF with the words provided. Runs of equal
+// consecutive words are collapsed into a single [a..b] range.
+func (e *Encoder) Encode(words []uint64) error {
+	if e.Width <= 0 || e.Width > 64 {
+		return fmt.Errorf("invalid MIF width %d", e.Width)
+	}
+	if e.Depth <= 0 {
+		return fmt.Errorf("invalid MIF depth %d", e.Depth)
+	}
+	if int64(len(words)) > e.Depth {
+		return fmt.Errorf("%d words do not fit in a MIF of depth %d", len(words),
+			e.Depth)
+	}
+
+	addrName, ok := formatName(e.AddrFormat)
+	if !ok {
+		return fmt.Errorf("invalid address format %d", e.AddrFormat)
+	}
+	dataName, ok := formatName(e.DataFormat)
+	if !ok {
+		return fmt.Errorf("invalid data format %d", e.DataFormat)
+	}
+
+	buf := bufio.NewWriter(e.w)
+
+	fmt.Fprintf(buf, "WIDTH=%d;\nDEPTH=%d;\nADDRESS_RADIX=%s;\nDATA_RADIX=%s;\n",
+		e.Width, e.Depth, addrName, dataName)
+	buf.WriteString("CONTENT BEGIN\n")
+
+	word := func(i int64) uint64 {
+		if i < int64(len(words)) {
+			return words[i]
+		}
+		return 0
+	}
+
+	for start := int64(0); start < e.Depth; {
+		v := word(start)
+		if e.Width < 64 && v>>e.Width != 0 {
+			return fmt.Errorf("word %d at address %d does not fit in %d bits", v,
+				start, e.Width)
+		}
+
+		end := start
+		for end+1 < e.Depth && word(end+1) == v {
+			end++
+		}
+
+		if start == end {
+			fmt.Fprintf(buf, "%s:%s;\n", e.formatAddr(start), e.formatData(v))
+		} else {
+			fmt.Fprintf(buf, "[%s..%s]:%s;\n", e.formatAddr(start),
+				e.formatAddr(end), e.formatData(v))
+		}
+		start = end + 1
+	}
+
+	buf.WriteString("END;\n")
+	return buf.Flush()
+}
+
+func (e *Encoder) formatAddr(addr int64) string {
+	return strings.ToUpper(strconv.FormatInt(addr, e.AddrFormat.base()))
+}
+
+// bitsPerDigit is the number of bits a single digit holds in formats where
+// words are padded with zeros.
+var bitsPerDigit = map[Format]int64{FormatBin: 1, FormatOct: 3, FormatHex: 4}
+
+// formatData formats a word. Signed decimals are written as negative when the
+// highest bit of the word is set, and binary, octal and hexadecimal words are
+// padded with zeros to the full width.
+func (e *Encoder) formatData(v uint64) string {
+	if e.DataFormat == FormatDec {
+		if e.Width < 64 && v>>(e.Width-1) != 0 {
+			return strconv.FormatInt(int64(v|^(1<<e.Width-1)), 10)
+		}
+		return strconv.FormatInt(int64(v), 10)
+	}
+
+	s := strconv.FormatUint(v, e.DataFormat.base())
+	if bits, ok := bitsPerDigit[e.DataFormat]; ok {
+		digits := (e.Width + bits - 1) / bits
+		if int64(len(s)) < digits {
+			s = strings.Repeat("0", int(digits)-len(s)) + s
+		}
+	}
+	return strings.ToUpper(s)
+}
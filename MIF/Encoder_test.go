@@ -0,0 +1,76 @@
+package MIF
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncodeRanges(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(&b)
+	e.Depth = 8
+	e.DataFormat = FormatUnsiged
+
+	if err := e.Encode([]uint64{5, 5, 5, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "WIDTH=16;\nDEPTH=8;\nADDRESS_RADIX=UNS;\nDATA_RADIX=UNS;\n" +
+		"CONTENT BEGIN\n[0..2]:5;\n3:1;\n4:2;\n[5..7]:0;\nEND;\n"
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	words := make([]uint64, 1<<15)
+	for i := range words {
+		if i%7 == 0 {
+			words[i] = uint64(i) & 0xffff
+		}
+	}
+	words[len(words)-1] = 0xffff
+
+	var b bytes.Buffer
+	e := NewEncoder(&b)
+	e.Depth = int64(len(words))
+	if err := e.Encode(words); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewParser(&b)
+	if err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	data := p.GetData()
+	for i, w := range words {
+		got := uint64(data[2*i])<<8 | uint64(data[2*i+1])
+		if got != w {
+			t.Fatalf("word %d = %d, want %d", i, got, w)
+		}
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(e *Encoder)
+		words []uint64
+		err   string
+	}{
+		{"too many words", func(e *Encoder) { e.Depth = 1 }, []uint64{1, 2}, "do not fit"},
+		{"word too wide", func(e *Encoder) { e.Width = 8 }, []uint64{256}, "does not fit"},
+		{"invalid width", func(e *Encoder) { e.Width = 65 }, nil, "invalid MIF width"},
+		{"invalid format", func(e *Encoder) { e.DataFormat = 3 }, nil, "invalid data format"},
+	}
+
+	for _, tt := range tests {
+		e := NewEncoder(&bytes.Buffer{})
+		e.Depth = 4
+		tt.setup(e)
+		if err := e.Encode(tt.words); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
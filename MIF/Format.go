@@ -1,8 +1,8 @@
 package MIF
 
 import (
+	"errors"
 	"fmt"
-	"strconv"
 )
 
 // Format defines the possible formats the MIF data can have
@@ -11,22 +11,136 @@ type Format int
 const (
 	FormatNone    = 0
 	FormatBin     = 2
+	FormatOct     = 8
 	FormatUnsiged = 10
+	FormatHex     = 16
+	FormatDec     = -10 // signed decimal, negative to differ from FormatUnsiged
 )
 
 // formatMap is the mapping of format identifiers to their respective Formats.
 var formatMap = map[string]Format{
 	"BIN": FormatBin,
+	"OCT": FormatOct,
 	"UNS": FormatUnsiged,
+	"DEC": FormatDec,
+	"HEX": FormatHex,
 }
 
-// readWithFormat reads a string containing a number in a specified MIF format
-// if the format has not been provided (aka f == FormatNone), the value
-// returned is implied from the prefix (0x, 0b, 0 or decimal).
-func (p *Parser) readWithFormat(v string, f Format) (int64, error) {
-	ret, err := strconv.ParseInt(v, int(f), 64)
+// base returns the numeric base numbers in a format are written in.
+func (f Format) base() int {
+	if f == FormatDec {
+		return 10
+	}
+	return int(f)
+}
+
+var (
+	errSyntax = errors.New("invalid syntax")
+	errRange  = errors.New("value out of range")
+)
+
+// digitValue is the value of each byte as a digit, 255 if it isn't one.
+var digitValue [256]byte
+
+func init() {
+	for i := range digitValue {
+		digitValue[i] = 255
+	}
+	for c := '0'; c <= '9'; c++ {
+		digitValue[c] = byte(c - '0')
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		digitValue[c] = byte(c-'a') + 10
+		digitValue[c-'a'+'A'] = byte(c-'a') + 10
+	}
+}
+
+// parseUint converts digits in a base to a number without allocating, like
+// strconv.ParseUint does for strings. Base 0 implies the base from the prefix.
+func parseUint(v []byte, base int) (uint64, error) {
+	if base == 0 {
+		base = 10
+		if len(v) > 1 && v[0] == '0' {
+			switch v[1] {
+			case 'x', 'X':
+				base, v = 16, v[2:]
+			case 'b', 'B':
+				base, v = 2, v[2:]
+			case 'o', 'O':
+				base, v = 8, v[2:]
+			default:
+				base, v = 8, v[1:]
+			}
+		}
+	}
+	if len(v) == 0 {
+		return 0, errSyntax
+	}
+
+	var n uint64
+	cutoff := ^uint64(0) / uint64(base)
+	for _, c := range v {
+		d := digitValue[c]
+		if int(d) >= base {
+			return 0, errSyntax
+		}
+		if n > cutoff {
+			return 0, errRange
+		}
+		n *= uint64(base)
+		if n+uint64(d) < n {
+			return 0, errRange
+		}
+		n += uint64(d)
+	}
+	return n, nil
+}
+
+// parseWithFormat parses a number written in a MIF format that must fit in
+// bits. Signed decimals are allowed to be negative, and are returned in two's
+// complement with that number of bits.
+func parseWithFormat(v []byte, f Format, bits int64) (uint64, error) {
+	if len(v) > 0 && v[0] == '-' {
+		if f != FormatDec {
+			return 0, fmt.Errorf("negative value %s is only valid with DEC radix", v)
+		}
+
+		mag, err := parseUint(v[1:], 10)
+		if err != nil {
+			return 0, err
+		}
+		if mag > 1<<63 {
+			return 0, errRange
+		}
+		if bits < 64 && mag > 1<<(bits-1) {
+			return 0, fmt.Errorf("value %s does not fit in %d bits", v, bits)
+		}
+
+		n := -mag // two's complement, in 64 bits
+		if bits < 64 {
+			n &= 1<<bits - 1
+		}
+		return n, nil
+	}
+
+	n, err := parseUint(v, f.base())
+	if err != nil {
+		return 0, err
+	}
+	if bits < 64 && n>>bits != 0 {
+		return 0, fmt.Errorf("value %s does not fit in %d bits", v, bits)
+	}
+	return n, nil
+}
+
+// readWithFormat reads a number in a specified MIF format that must fit in a
+// number of bits, returning a parser error if it does not.
+// If the format has not been provided (aka f == FormatNone), the base is
+// implied from the prefix (0x, 0b, 0 or decimal).
+func (p *Parser) readWithFormat(v []byte, f Format, bits int64) (uint64, error) {
+	ret, err := parseWithFormat(v, f, bits)
 	if err != nil {
-		err = p.newError(fmt.Sprintf("invalid number: %s", err.Error()))
+		err = p.newError(fmt.Sprintf("invalid number %s: %s", v, err.Error()))
 	}
 	return ret, err
 }
@@ -0,0 +1,128 @@
+package MIF
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// parseString parses a MIF with the given radixes, width and content.
+func parseString(addr, data string, width int, content string) (*Parser, error) {
+	src := "WIDTH=" + strconv.Itoa(width) + ";\nDEPTH=4;\nADDRESS_RADIX=" + addr +
+		";\nDATA_RADIX=" + data + ";\nCONTENT BEGIN\n" + content + "END;\n"
+	p := NewParser(strings.NewReader(src))
+	return p, p.Parse()
+}
+
+func TestRadixes(t *testing.T) {
+	tests := []struct {
+		addr, data string
+		width      int
+		content    string
+		want       []byte
+	}{
+		{"UNS", "BIN", 8, "0:00000001;\n[1..3]:10;\n", []byte{1, 2, 2, 2}},
+		{"HEX", "HEX", 8, "0:FF;\n1:a0;\n[2..3]:0B;\n", []byte{0xff, 0xa0, 0x0b, 0x0b}},
+		{"OCT", "OCT", 8, "0:377;\n3:17;\n", []byte{0o377, 0, 0, 0o17}},
+		{"DEC", "DEC", 8, "0:-1;\n1:-128;\n2:127;\n3:-2 3;\n", []byte{0xff, 0x80, 127, 0xfe}},
+		{"UNS", "UNS", 16, "[0..3]:-- comment\n 1 2;\n", []byte{0, 1, 0, 2, 0, 1, 0, 2}},
+		{"HEX", "DEC", 16, "A:1;\n", nil},
+	}
+
+	for _, tt := range tests {
+		p, err := parseString(tt.addr, tt.data, tt.width, tt.content)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.content)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.content, err)
+			continue
+		}
+		if !bytes.Equal(p.GetData(), tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.content, p.GetData(), tt.want)
+		}
+	}
+}
+
+func TestRadixErrors(t *testing.T) {
+	tests := []struct {
+		data    string
+		width   int
+		content string
+		err     string
+	}{
+		{"DEC", 8, "0:-129;\n", "does not fit in 8 bits"},
+		{"DEC", 8, "0:256;\n", "does not fit in 8 bits"},
+		{"UNS", 8, "0:-1;\n", "only valid with DEC"},
+		{"HEX", 8, "0:1FF;\n", "does not fit in 8 bits"},
+		{"OCT", 8, "0:8;\n", "invalid number"},
+		{"BIN", 8, "4:0;\n", "between 0 and DEPTH"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseString("UNS", tt.data, tt.width, tt.content)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s %s: got error %v, want %q", tt.data, tt.content, err, tt.err)
+		}
+	}
+}
+
+func TestEncodeRadixes(t *testing.T) {
+	words := []uint64{0xff, 0x80, 0x0b, 0}
+	for name, f := range formatMap {
+		var b bytes.Buffer
+		e := NewEncoder(&b)
+		e.Width, e.Depth, e.AddrFormat, e.DataFormat = 8, 4, f, f
+		if err := e.Encode(words); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		p := NewParser(&b)
+		if err := p.Parse(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(p.GetData(), []byte{0xff, 0x80, 0x0b, 0}) {
+			t.Errorf("%s: round trip gave %v", name, p.GetData())
+		}
+	}
+}
+
+func TestOddWidths(t *testing.T) {
+	tests := []struct {
+		width   int
+		content string
+		words   []uint64
+		data    []byte
+	}{
+		{14, "0:11111111111111;\n1:10000000000001;\n", []uint64{0x3fff, 0x2001, 0, 0},
+			[]byte{0x3f, 0xff, 0x20, 0x01, 0, 0, 0, 0}},
+		{6, "[0..3]:101010 000001;\n", []uint64{42, 1, 42, 1}, []byte{42, 1, 42, 1}},
+		{1, "0:1;\n2:1;\n", []uint64{1, 0, 1, 0}, []byte{1, 0, 1, 0}},
+		{24, "3:101010101010101010101010;\n", []uint64{0, 0, 0, 0xaaaaaa},
+			[]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0xaa, 0xaa, 0xaa}},
+	}
+
+	for _, tt := range tests {
+		p, err := parseString("UNS", "BIN", tt.width, tt.content)
+		if err != nil {
+			t.Errorf("width %d: %v", tt.width, err)
+			continue
+		}
+		for i, w := range p.GetWords() {
+			if w != tt.words[i] {
+				t.Errorf("width %d: word %d = %b, want %b", tt.width, i, w, tt.words[i])
+			}
+		}
+		if !bytes.Equal(p.GetData(), tt.data) {
+			t.Errorf("width %d: data %v, want %v", tt.width, p.GetData(), tt.data)
+		}
+	}
+
+	if _, err := parseString("UNS", "BIN", 6, "0:1000000;\n"); err == nil {
+		t.Errorf("a 7 bit value was accepted with width 6")
+	}
+}
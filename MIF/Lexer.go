@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"unicode"
 )
 
 // Lexer defines a MIF lexer, reading tokens one at a time.
@@ -14,17 +13,42 @@ type Lexer struct {
 	col      int
 	lastTok  Token
 	rewinded bool
+	lastCol  int  // the column before the last byte read, to unread it
+	lastByte byte // the last byte read, to unread it
 
-	dataValue string // used to store identifier strings when read
+	// the identifier or number last read, reused between tokens so that
+	// reading them does not allocate.
+	data []byte
+}
+
+// identChar tells if a byte can be part of an identifier or number, and
+// isSpace if it is a whitespace. Only ASCII is valid in a MIF.
+var identChar, isSpace [256]bool
+
+func init() {
+	for c := 0; c < 256; c++ {
+		identChar[c] = c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			c >= '0' && c <= '9' || c == '_'
+	}
+	for _, c := range []byte(" \t\n\r\v\f") {
+		isSpace[c] = true
+	}
 }
 
 func NewLexer(rd io.Reader) *Lexer {
 	bufrd := bufio.NewReader(rd)
-	return &Lexer{stream: bufrd, line: 1, col: 1}
+	return &Lexer{stream: bufrd, line: 1, col: 1, data: make([]byte, 0, 64)}
 }
 
+// GetData returns the last identifier or number read as a string.
 func (l *Lexer) GetData() string {
-	return l.dataValue
+	return string(l.data)
+}
+
+// GetBytes returns the last identifier or number read without allocating. The
+// slice is only valid until the next token is read.
+func (l *Lexer) GetBytes() []byte {
+	return l.data
 }
 
 func (l *Lexer) GetPosition() (int, int) {
@@ -32,7 +56,7 @@ func (l *Lexer) GetPosition() (int, int) {
 }
 
 func (l *Lexer) newError(cause string) error {
-	return MIFError{"lexer", l.line, l.col, cause}
+	return MIFError{"lexer", l.line, l.col, cause, SeverityError}
 }
 
 func (l *Lexer) readByte() (byte, error) {
@@ -40,6 +64,7 @@ func (l *Lexer) readByte() (byte, error) {
 	if err != nil {
 		return byte('\x00'), err
 	}
+	l.lastCol, l.lastByte = l.col, c
 	if c == '\n' {
 		l.line++
 		l.col = 1
@@ -49,6 +74,18 @@ func (l *Lexer) readByte() (byte, error) {
 	return c, nil
 }
 
+// unreadByte undoes the last readByte, including the position change.
+func (l *Lexer) unreadByte() error {
+	if err := l.stream.UnreadByte(); err != nil {
+		return err
+	}
+	if l.lastByte == '\n' {
+		l.line--
+	}
+	l.col = l.lastCol
+	return nil
+}
+
 func (l *Lexer) readUntil(end byte) (err error) {
 	for c := byte(' '); c != end; c, err = l.readByte() {
 		if err != nil {
@@ -58,23 +95,37 @@ func (l *Lexer) readUntil(end byte) (err error) {
 	return
 }
 
-func (l *Lexer) readIdent() (err error) {
-	var c byte
+// readIdent appends an identifier or number to data, stopping before the
+// first byte that can't be a part of it or at the end of the input.
+func (l *Lexer) readIdent() error {
+	// scan what is already buffered at once, which is almost always enough
+	buf, _ := l.stream.Peek(l.stream.Buffered())
+	n := 0
+	for n < len(buf) && identChar[buf[n]] {
+		n++
+	}
+	l.data = append(l.data, buf[:n]...)
+	l.col += n
+	if _, err := l.stream.Discard(n); err != nil {
+		return err
+	}
+	if n < len(buf) {
+		return nil
+	}
 
-	l.dataValue = ""
 	for {
-		if c, err = l.readByte(); err != nil {
-			break
+		c, err := l.readByte()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
 		}
-		if !unicode.IsLetter(rune(c)) && c != '_' && !unicode.IsNumber(rune(c)) {
-			err = l.stream.UnreadByte()
-			break
+		if !identChar[c] {
+			return l.unreadByte()
 		}
 
-		l.dataValue += string(c)
+		l.data = append(l.data, c)
 	}
-
-	return
 }
 
 // nextToken reads the next token in the stream regardless if the lexer was
@@ -87,7 +138,7 @@ func (l *Lexer) nextToken() (Token, error) {
 
 	// ignore whitespaces
 	c := byte(' ')
-	for unicode.IsSpace(rune(c)) {
+	for isSpace[c] {
 		c, err = l.readByte()
 		if err != nil {
 			return TokNone, err
@@ -95,31 +146,28 @@ func (l *Lexer) nextToken() (Token, error) {
 	}
 
 	// if we found an identifier or number, read it
-	if unicode.IsLetter(rune(c)) || unicode.IsNumber(rune(c)) || c == '_' {
-		if err = l.stream.UnreadByte(); err != nil {
-			return TokNone, err
-		}
+	if identChar[c] {
+		l.data = append(l.data[:0], c)
 		if err = l.readIdent(); err != nil {
 			return TokNone, err
 		}
 
-		// diferentiate keywords from normal identifiers
-		if l.dataValue == "CONTENT" {
+		// diferentiate keywords from normal identifiers, the conversions
+		// here do not allocate.
+		switch string(l.data) {
+		case "CONTENT":
 			return TokContent, nil
-		}
-		if l.dataValue == "BEGIN" {
+		case "BEGIN":
 			return TokBegin, nil
-		}
-		if l.dataValue == "END" {
+		case "END":
 			return TokEnd, nil
 		}
 
 		// and numbers from identifiers
-		if unicode.IsNumber(rune(c)) {
+		if c >= '0' && c <= '9' {
 			return TokNumber, nil
-		} else {
-			return TokIdent, nil
 		}
+		return TokIdent, nil
 	}
 
 	// read all other tokens
@@ -131,12 +179,20 @@ func (l *Lexer) nextToken() (Token, error) {
 		}
 		return l.nextToken()
 	case '-':
-		// -- is a single line comment, a single - does not exist in our syntax
+		// -- is a single line comment, and a - before a digit is a negative
+		// number, a single - does not exist in our syntax
 		if c, err = l.readByte(); err != nil {
 			return TokNone, err
 		}
+		if c >= '0' && c <= '9' {
+			l.data = append(l.data[:0], '-', c)
+			if err = l.readIdent(); err != nil {
+				return TokNone, err
+			}
+			return TokNumber, nil
+		}
 		if c != '-' {
-			return TokNone, l.newError("expected '-'")
+			return TokNone, l.newError("expected '-' or a digit")
 		}
 		if err = l.readUntil('\n'); err != nil {
 			return TokEnd, err
@@ -0,0 +1,96 @@
+package MIF
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// fullCodeMIF returns a code MIF with every one of the 32K words defined on
+// it's own line, the worst case for the lexer.
+func fullCodeMIF() []byte {
+	words := make([]uint64, 1<<15)
+	for i := range words {
+		words[i] = uint64(i*7919) & 0xffff
+	}
+	// consecutive words are never equal, so no ranges are collapsed
+	for i := 1; i < len(words); i++ {
+		if words[i] == words[i-1] {
+			words[i] ^= 1
+		}
+	}
+
+	var b bytes.Buffer
+	e := NewEncoder(&b)
+	e.Depth = int64(len(words))
+	if err := e.Encode(words); err != nil {
+		panic(err)
+	}
+	return b.Bytes()
+}
+
+func TestLexerTokens(t *testing.T) {
+	src := "WIDTH=16; -- comment\n% multi\nline % [0..1F]:-12 ab_1;\nCONTENT BEGIN END"
+	want := []struct {
+		tok  Token
+		data string
+	}{
+		{TokIdent, "WIDTH"}, {TokEq, ""}, {TokNumber, "16"}, {TokStmtEnd, ""},
+		{TokOpen, ""}, {TokNumber, "0"}, {TokRange, ""}, {TokNumber, "1F"},
+		{TokClose, ""}, {TokColon, ""}, {TokNumber, "-12"}, {TokIdent, "ab_1"},
+		{TokStmtEnd, ""}, {TokContent, ""}, {TokBegin, ""}, {TokEnd, ""},
+		{TokEOF, ""},
+	}
+
+	l := NewLexer(strings.NewReader(src))
+	for i, w := range want {
+		tok, err := l.NextToken()
+		if err != nil {
+			t.Fatalf("token %d: %v", i, err)
+		}
+		if tok != w.tok {
+			t.Fatalf("token %d is %v, want %v", i, tok, w.tok)
+		}
+		if w.data != "" && l.GetData() != w.data {
+			t.Errorf("token %d has data %q, want %q", i, l.GetData(), w.data)
+		}
+	}
+
+	if line, _ := l.GetPosition(); line != 4 {
+		t.Errorf("lexer ended at line %d, want 4", line)
+	}
+}
+
+func BenchmarkParseFullCodeMIF(b *testing.B) {
+	src := fullCodeMIF()
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		p := NewParser(bytes.NewReader(src))
+		if err := p.Parse(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLexFullCodeMIF(b *testing.B) {
+	src := fullCodeMIF()
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		l := NewLexer(bytes.NewReader(src))
+		for {
+			tok, err := l.NextToken()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if tok == TokEOF {
+				break
+			}
+		}
+	}
+}
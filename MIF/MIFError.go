@@ -1,6 +1,25 @@
 package MIF
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity tells if a MIFError stops the MIF from being used or is just a
+// warning about something suspicious.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
 
 // MIFError denotes a parsing or lexer error at a certain position of a MIF
 // file.
@@ -9,9 +28,45 @@ type MIFError struct {
 	line      int
 	col       int
 	cause     string
+	severity  Severity
 }
 
 func (e MIFError) Error() string {
+	if e.severity == SeverityWarning {
+		return fmt.Sprintf("%s warning at line %d, col %d: %s", e.component,
+			e.line, e.col, e.cause)
+	}
 	return fmt.Sprintf("%s failed at line %d, col %d: %s", e.component, e.line,
 		e.col, e.cause)
 }
+
+// Position returns the line and column the error happened at.
+func (e MIFError) Position() (int, int) {
+	return e.line, e.col
+}
+
+func (e MIFError) Severity() Severity {
+	return e.severity
+}
+
+// ErrorList is every error and warning found while parsing a MIF, in the
+// order they appear in the file.
+type ErrorList []MIFError
+
+func (el ErrorList) Error() string {
+	lines := make([]string, len(el))
+	for i, e := range el {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// HasErrors returns if the list has anything other than warnings.
+func (el ErrorList) HasErrors() bool {
+	for _, e := range el {
+		if e.severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package MIF
+
+import "sort"
+
+// Limits bounds the resources a Parser may use, so that a malformed or
+// malicious MIF can't exhaust memory. Zero means no limit.
+type Limits struct {
+	MaxDepth  int64 // the largest DEPTH accepted
+	MaxValues int64 // the most values stored, across all definitions
+}
+
+// DefaultLimits are the Limits a new Parser starts with: a 32 bit address
+// space, with no more values stored than in a 16M words memory.
+var DefaultLimits = Limits{MaxDepth: 1 << 32, MaxValues: 1 << 24}
+
+// Segment is a range of consecutive addresses defined in the content of a MIF,
+// with the values repeating over the range as in the definition.
+type Segment struct {
+	Start, End int64 // first and last address, inclusive
+
+	origin int64    // the address the values start at, before or at Start
+	values []uint64 // the values of the definition, repeated
+}
+
+// At returns the value of an address inside the segment.
+func (s Segment) At(addr int64) uint64 {
+	return s.values[(addr-s.origin)%int64(len(s.values))]
+}
+
+// Memory is the sparse content of a MIF: only the addresses defined are
+// stored, as sorted and non overlapping segments, and all others are zero.
+type Memory struct {
+	Width, Depth int64
+	segments     []Segment
+}
+
+// set defines the addresses from start to end (inclusive), repeating values
+// over them. It returns the first address that was already defined and is now
+// overwritten, or -1 if none was.
+func (m *Memory) set(start, end int64, values []uint64) int64 {
+	seg := Segment{Start: start, End: end, origin: start, values: values}
+
+	// MIFs are almost always written in order, so just append in that case
+	n := len(m.segments)
+	if n == 0 || m.segments[n-1].End < start {
+		m.segments = append(m.segments, seg)
+		return -1
+	}
+
+	// segments i to j-1 overlap the new one, and are cut or replaced by it
+	i := sort.Search(n, func(k int) bool { return m.segments[k].End >= start })
+	j := sort.Search(n, func(k int) bool { return m.segments[k].Start > end })
+
+	overlap := int64(-1)
+	repl := make([]Segment, 0, 3)
+	if i < j {
+		first, last := m.segments[i], m.segments[j-1]
+
+		overlap = start
+		if first.Start > start {
+			overlap = first.Start
+		}
+
+		if first.Start < start {
+			first.End = start - 1
+			repl = append(repl, first)
+		}
+		repl = append(repl, seg)
+		if last.End > end {
+			last.Start = end + 1
+			repl = append(repl, last)
+		}
+	} else {
+		repl = append(repl, seg)
+	}
+
+	rest := append([]Segment{}, m.segments[j:]...)
+	m.segments = append(append(m.segments[:i], repl...), rest...)
+	return overlap
+}
+
+// At returns the value at an address, zero if it was never defined.
+func (m *Memory) At(addr int64) uint64 {
+	i := sort.Search(len(m.segments), func(k int) bool {
+		return m.segments[k].End >= addr
+	})
+	if i < len(m.segments) && m.segments[i].Start <= addr {
+		return m.segments[i].At(addr)
+	}
+	return 0
+}
+
+// Segments returns the defined ranges of addresses, in order.
+func (m *Memory) Segments() []Segment {
+	return m.segments
+}
+
+// Defined returns how many addresses were defined.
+func (m *Memory) Defined() int64 {
+	var n int64
+	for _, s := range m.segments {
+		n += s.End - s.Start + 1
+	}
+	return n
+}
+
+// FirstUndefined returns the lowest address never defined, or -1 if all of
+// them were.
+func (m *Memory) FirstUndefined() int64 {
+	next := int64(0)
+	for _, s := range m.segments {
+		if s.Start > next {
+			break
+		}
+		next = s.End + 1
+	}
+	if next >= m.Depth {
+		return -1
+	}
+	return next
+}
+
+// Each calls fn with every defined address and it's value, in order, until
+// fn returns false. Addresses never defined are skipped.
+func (m *Memory) Each(fn func(addr int64, v uint64) bool) {
+	for _, s := range m.segments {
+		for a := s.Start; a <= s.End; a++ {
+			if !fn(a, s.At(a)) {
+				return
+			}
+		}
+	}
+}
+
+// Words returns the whole memory, with one word per address. This allocates
+// DEPTH words, so the dimensions should be checked before calling it.
+func (m *Memory) Words() []uint64 {
+	words := make([]uint64, m.Depth)
+	m.Each(func(addr int64, v uint64) bool {
+		words[addr] = v
+		return true
+	})
+	return words
+}
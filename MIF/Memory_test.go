@@ -0,0 +1,97 @@
+package MIF
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemorySet(t *testing.T) {
+	m := &Memory{Width: 8, Depth: 20}
+
+	steps := []struct {
+		start, end int64
+		values     []uint64
+		overlap    int64
+	}{
+		{0, 9, []uint64{1}, -1},
+		{12, 15, []uint64{2, 3}, -1},
+		{5, 6, []uint64{4}, 5},
+		{8, 13, []uint64{5}, 8},
+		{17, 17, []uint64{6}, -1},
+		{16, 16, []uint64{7}, -1},
+	}
+	for _, s := range steps {
+		if o := m.set(s.start, s.end, s.values); o != s.overlap {
+			t.Errorf("set(%d, %d) overlapped at %d, want %d", s.start, s.end, o,
+				s.overlap)
+		}
+	}
+
+	want := []uint64{1, 1, 1, 1, 1, 4, 4, 1, 5, 5, 5, 5, 5, 5, 2, 3, 7, 6, 0, 0}
+	for a, w := range want {
+		if v := m.At(int64(a)); v != w {
+			t.Errorf("At(%d) = %d, want %d", a, v, w)
+		}
+	}
+	for a, v := range m.Words() {
+		if v != want[a] {
+			t.Errorf("Words()[%d] = %d, want %d", a, v, want[a])
+		}
+	}
+
+	if d := m.Defined(); d != 18 {
+		t.Errorf("Defined() = %d, want 18", d)
+	}
+	if f := m.FirstUndefined(); f != 18 {
+		t.Errorf("FirstUndefined() = %d, want 18", f)
+	}
+
+	// segments must stay sorted and without overlaps
+	segs := m.Segments()
+	for i := 1; i < len(segs); i++ {
+		if segs[i].Start <= segs[i-1].End {
+			t.Errorf("segments %v and %v overlap", segs[i-1], segs[i])
+		}
+	}
+}
+
+func TestLargeDepth(t *testing.T) {
+	src := "WIDTH=8;\nDEPTH=4000000000;\nADDRESS_RADIX=HEX;\nDATA_RADIX=HEX;\n" +
+		"CONTENT BEGIN\n0:1;\n[EE6B27F0..EE6B27FF]:AB CD;\nEND;\n"
+
+	p := NewParser(strings.NewReader(src))
+	if err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := p.GetMemory()
+	var addrs []int64
+	m.Each(func(addr int64, v uint64) bool {
+		addrs = append(addrs, addr)
+		return len(addrs) < 3
+	})
+	if len(addrs) != 3 || addrs[0] != 0 || addrs[1] != 0xEE6B27F0 || addrs[2] != 0xEE6B27F1 {
+		t.Errorf("Each visited %x", addrs)
+	}
+	if m.At(0xEE6B27F1) != 0xcd || m.At(5) != 0 {
+		t.Errorf("wrong values in the sparse memory")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	header := "WIDTH=8;\nDEPTH=%s;\nADDRESS_RADIX=UNS;\nDATA_RADIX=UNS;\nCONTENT BEGIN\n"
+
+	p := NewParser(strings.NewReader(strings.Replace(header, "%s", "100000000000", 1) +
+		"END;\n"))
+	if err := p.Parse(); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("got error %v for a DEPTH over the limit", err)
+	}
+
+	p = NewParser(strings.NewReader(strings.Replace(header, "%s", "16", 1) +
+		"[0..3]:1 2 3;\n4:4;\n5:5;\nEND;\n"))
+	p.SetLimits(Limits{MaxValues: 4})
+	err := p.Parse()
+	if err == nil || !strings.Contains(err.Error(), "limit of 4 values") {
+		t.Errorf("got error %v for too many values", err)
+	}
+}
@@ -14,25 +14,141 @@ type Parser struct {
 	dataFormat Format
 	addrFormat Format
 
-	dataArray []byte
+	mem    *Memory // the content, nil until CONTENT is read
+	limits Limits
+	stored int64    // values stored in mem until now, bounded by the limits
+	arena  []uint64 // backing array of the values, to allocate them in bulk
+
+	errs ErrorList // all errors and warnings found until now
 }
 
+// maxErrors is the number of errors after which parsing gives up, to avoid
+// reporting one error per token of a file that is not a MIF at all.
+const maxErrors = 50
+
 func NewParser(rd io.Reader) *Parser {
 	l := NewLexer(rd)
-	return &Parser{l: l}
+	return &Parser{l: l, limits: DefaultLimits}
+}
+
+// SetLimits changes the limits checked while parsing, must be called before
+// Parse.
+func (p *Parser) SetLimits(limits Limits) {
+	p.limits = limits
 }
 
 func (p *Parser) GetDimensions() (int64, int64) {
 	return p.width, p.depth
 }
 
+// GetMemory returns the sparse content of the MIF, that can be inspected
+// without allocating DEPTH words.
+func (p *Parser) GetMemory() *Memory {
+	return p.mem
+}
+
+// GetWords returns the words defined in the MIF, one for each address. As
+// DEPTH words are allocated, check GetDimensions first for large MIFs.
+func (p *Parser) GetWords() []uint64 {
+	if p.mem == nil {
+		return nil
+	}
+	return p.mem.Words()
+}
+
+// GetData returns the words defined in the MIF as bytes, in big endian order,
+// with each word taking as many bytes as needed to hold WIDTH bits. Like
+// GetWords, the whole memory is allocated.
 func (p *Parser) GetData() []byte {
-	return p.dataArray
+	words := p.GetWords()
+	if words == nil {
+		return nil
+	}
+
+	n := (p.width + 7) / 8
+	data := make([]byte, 0, int64(len(words))*n)
+	for _, w := range words {
+		for j := n - 1; j >= 0; j-- {
+			data = append(data, byte(w>>(8*j)))
+		}
+	}
+	return data
+}
+
+// GetErrors returns every error and warning found by Parse. If Parse did not
+// return an error, they are all warnings.
+func (p *Parser) GetErrors() ErrorList {
+	return p.errs
 }
 
 func (p *Parser) newError(cause string) error {
 	l, c := p.l.GetPosition()
-	return MIFError{"parser", l, c, cause}
+	return MIFError{"parser", l, c, cause, SeverityError}
+}
+
+func (p *Parser) warn(cause string) {
+	l, c := p.l.GetPosition()
+	p.errs = append(p.errs, MIFError{"parser", l, c, cause, SeverityWarning})
+}
+
+// fatal records an error that parsing can't continue after, and returns it
+// with all errors found until now.
+func (p *Parser) fatal(cause string) error {
+	p.errs = append(p.errs, p.newError(cause).(MIFError))
+	return p.errs
+}
+
+// report records an error so that parsing can continue after it. Errors that
+// are not a MIFError (such as a failed read) or too many errors can not be
+// recovered from, and are returned.
+func (p *Parser) report(err error) error {
+	merr, ok := err.(MIFError)
+	if !ok {
+		return err
+	}
+
+	p.errs = append(p.errs, merr)
+	if len(p.errs) >= maxErrors {
+		return p.errs
+	}
+	return nil
+}
+
+// sync skips tokens until the end of the statement an error happened in, so
+// that the next one can be parsed. It stops before END, CONTENT and EOF, as
+// those start or end whole sections and are never inside a statement.
+func (p *Parser) sync() error {
+	// the error may have been found after the statement ended
+	if p.l.lastTok == TokStmtEnd && !p.l.rewinded {
+		return nil
+	}
+
+	for {
+		tok, err := p.l.NextToken()
+		if err != nil {
+			// errors inside a statement being skipped are not reported
+			if _, ok := err.(MIFError); ok {
+				continue
+			}
+			return err
+		}
+
+		switch tok {
+		case TokStmtEnd:
+			return nil
+		case TokEnd, TokContent, TokEOF:
+			p.l.UnReadToken()
+			return nil
+		}
+	}
+}
+
+// recover reports an error and skips the statement it happened in.
+func (p *Parser) recover(err error) error {
+	if err = p.report(err); err != nil {
+		return err
+	}
+	return p.sync()
 }
 
 // expect reads a single token, and if it is not in the list provided, returns
@@ -49,21 +165,37 @@ func (p *Parser) expect(expected []Token) (Token, error) {
 		}
 	}
 
+	// formatting a copy keeps expected from escaping, so that calls with a
+	// slice literal do not allocate
+	exp := append([]Token(nil), expected...)
+
 	p.l.UnReadToken()
 	return TokNone, p.newError(
-		fmt.Sprintf("unexpected token %v in input, wanted %v", tok, expected),
+		fmt.Sprintf("unexpected token %v in input, wanted %v", tok, exp),
 	)
 }
 
+// numberTokens are the tokens a number can be read as: hexadecimal numbers
+// starting with a letter are read by the lexer as identifiers.
+var numberTokens = []Token{TokNumber, TokIdent}
+
+// addressTokens are the tokens an address definition can start with.
+var addressTokens = []Token{TokOpen, TokNumber, TokIdent}
+
 // readAddress reads a single number from the input and returns it's value as
-// interpreted by the address Format.
+// interpreted by the address Format, checking that it is not after DEPTH.
+// DEPTH itself is not a valid address, but is returned for the caller to
+// decide what to do with it.
 func (p *Parser) readAddress() (int64, error) {
-	if _, err := p.expect([]Token{TokNumber}); err != nil {
+	if _, err := p.expect(numberTokens); err != nil {
 		return 0, err
 	}
-	v, err := p.readWithFormat(p.l.GetData(), p.addrFormat)
+	v, err := p.readWithFormat(p.l.GetBytes(), p.addrFormat, 64)
 	if err != nil {
 		return 0, err
 	}
-	return v, nil
+	if v > uint64(p.depth) {
+		return 0, p.newError("address must be between 0 and DEPTH-1")
+	}
+	return int64(v), nil
 }
@@ -1,6 +1,7 @@
 package MIF
 
 import (
+	"fmt"
 	"strconv"
 )
 
@@ -17,33 +18,77 @@ import (
 // Parse initiates the recursive descend parsing of a MIF file.
 // After the function returns, all other Parser methods are populated with
 // valid data.
+//
+// Parsing does not stop at the first error: the statement with the error is
+// skipped and parsing continues after the next ';', so that all errors can be
+// fixed at once. If any error was found an ErrorList with all errors and
+// warnings is returned, and GetErrors returns the warnings otherwise.
 // Start -> header data EOF
 func (p *Parser) Parse() error {
+	if err := p.parse(); err != nil {
+		if _, ok := err.(ErrorList); !ok {
+			return err
+		}
+	}
+
+	if p.errs.HasErrors() {
+		return p.errs
+	}
+	return nil
+}
+
+// parse implements Parse, returning only errors that can't be recovered from.
+func (p *Parser) parse() error {
 	var err error
 
 	if err = p.header(); err != nil {
 		return err
 	}
 
-	if p.addrFormat == FormatNone {
-		return p.newError("ADDRESS_RADIX not defined before CONTENT")
+	// the content can't be read without a valid header, stop here if so
+	headerOk := true
+	check := func(ok bool, cause string) error {
+		if ok {
+			return nil
+		}
+		headerOk = false
+		return p.report(p.newError(cause))
 	}
-	if p.dataFormat == FormatNone {
-		return p.newError("DATA_RADIX not defined before CONTENT")
+	if err = check(p.addrFormat != FormatNone,
+		"ADDRESS_RADIX not defined before CONTENT"); err != nil {
+		return err
 	}
-	if p.depth <= 0 {
-		return p.newError("DEPTH undefined before CONTENT or with invalid value")
+	if err = check(p.dataFormat != FormatNone,
+		"DATA_RADIX not defined before CONTENT"); err != nil {
+		return err
 	}
-	if p.width <= 0 {
-		return p.newError("WIDTH undefined before CONTENT or with invalid value")
+	if err = check(p.depth > 0,
+		"DEPTH undefined before CONTENT or with invalid value"); err != nil {
+		return err
+	}
+	if err = check(p.limits.MaxDepth == 0 || p.depth <= p.limits.MaxDepth,
+		fmt.Sprintf("DEPTH %d is larger than the limit of %d", p.depth,
+			p.limits.MaxDepth)); err != nil {
+		return err
+	}
+	if err = check(p.width > 0 && p.width <= 64,
+		"WIDTH undefined before CONTENT or with invalid value"); err != nil {
+		return err
+	}
+	if !headerOk {
+		return nil
 	}
 
 	if err = p.data(); err != nil {
 		return err
 	}
 
+	// after errors in the content, whatever comes next was already reported
+	if p.errs.HasErrors() {
+		return nil
+	}
 	if _, err = p.expect([]Token{TokEOF}); err != nil {
-		return err
+		return p.report(err)
 	}
 
 	return nil
@@ -54,7 +99,10 @@ func (p *Parser) header() error {
 	for {
 		tok, err := p.l.NextToken()
 		if err != nil {
-			return err
+			if err = p.recover(err); err != nil {
+				return err
+			}
+			continue
 		}
 		p.l.UnReadToken()
 
@@ -62,7 +110,9 @@ func (p *Parser) header() error {
 			break
 		}
 		if err = p.declaration(); err != nil {
-			return err
+			if err = p.recover(err); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -88,10 +138,17 @@ func (p *Parser) declaration() (err error) {
 
 	var ok bool
 	switch ident {
-	case "DEPTH":
-		p.depth, err = strconv.ParseInt(value, 10, 64)
-	case "WIDTH":
-		p.width, err = strconv.ParseInt(value, 10, 64)
+	case "DEPTH", "WIDTH":
+		n, perr := strconv.ParseInt(value, 10, 64)
+		if perr != nil {
+			return p.newError(fmt.Sprintf("invalid %s %s: %s", ident, value,
+				perr.Error()))
+		}
+		if ident == "DEPTH" {
+			p.depth = n
+		} else {
+			p.width = n
+		}
 	case "DATA_RADIX":
 		p.dataFormat, ok = formatMap[value]
 		if !ok {
@@ -113,10 +170,10 @@ func (p *Parser) data() error {
 	var err error
 
 	if _, err = p.expect([]Token{TokContent}); err != nil {
-		return err
+		return p.report(err)
 	}
 	if _, err = p.expect([]Token{TokBegin}); err != nil {
-		return err
+		return p.report(err)
 	}
 
 	if err = p.addressDefs(); err != nil {
@@ -124,31 +181,39 @@ func (p *Parser) data() error {
 	}
 
 	if _, err = p.expect([]Token{TokEnd}); err != nil {
-		return err
+		return p.report(err)
 	}
 	if _, err = p.expect([]Token{TokStmtEnd}); err != nil {
-		return err
+		return p.report(err)
 	}
 
+	p.checkUndefined()
 	return nil
 }
 
 // addressDefs -> definition addressDefs | eps
 func (p *Parser) addressDefs() error {
-	p.dataArray = make([]byte, p.width*p.depth/8)
+	p.mem = &Memory{Width: p.width, Depth: p.depth}
 
 	for {
 		tok, err := p.l.NextToken()
 		if err != nil {
-			return err
+			if err = p.recover(err); err != nil {
+				return err
+			}
+			continue
 		}
 		p.l.UnReadToken()
 
-		if tok != TokOpen && tok != TokNumber {
+		// anything other than the end is parsed as a definition, so that an
+		// invalid one is reported instead of just ending the content
+		if tok == TokEnd || tok == TokEOF || tok == TokContent {
 			break
 		}
 		if err = p.definition(); err != nil {
-			return err
+			if err = p.recover(err); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -171,39 +236,53 @@ func (p *Parser) definition() error {
 		return err
 	}
 
-	k := 0
-	for i := start; i <= end; i++ {
-		kvalue := values[k]
-		for j := int64(0); j < p.width/8; j++ {
-			p.dataArray[i*p.width/8+j] = byte(kvalue >> (p.width - (j+1)*8))
-		}
-		k = (k + 1) % len(values)
+	overlap := p.mem.set(start, end, values)
+	if overlap != -1 {
+		p.warn(fmt.Sprintf("address %d was already defined, the old value is overwritten",
+			overlap))
 	}
 
 	return nil
 }
 
-// address -> (TokOpen TokNumber TokRange TokNumber TokClose | TokNumber)
+// checkUndefined warns about the addresses never defined in the content, that
+// are zero.
+func (p *Parser) checkUndefined() {
+	first, count := p.mem.FirstUndefined(), p.depth-p.mem.Defined()
+	if count == 1 {
+		p.warn(fmt.Sprintf("address %d is never defined and will be zero", first))
+	} else if count > 1 {
+		p.warn(fmt.Sprintf(
+			"%d addresses are never defined and will be zero, the first is %d",
+			count, first))
+	}
+}
+
+// address -> (TokOpen number TokRange number TokClose | number)
 func (p *Parser) address() (int64, int64, error) {
 	var start, end int64
 
-	tok, err := p.expect([]Token{TokOpen, TokNumber})
+	tok, err := p.expect(addressTokens)
 	if err != nil {
 		return 0, 0, err
 	}
 
-	if tok == TokNumber {
-		if start, err = p.readWithFormat(p.l.GetData(), p.addrFormat); err != nil {
+	if tok != TokOpen {
+		p.l.UnReadToken()
+		if start, err = p.readAddress(); err != nil {
 			return 0, 0, err
 		}
+		if start == p.depth {
+			return 0, 0, p.newError("address must be between 0 and DEPTH-1")
+		}
 		return start, start, nil
 	}
 
 	if start, err = p.readAddress(); err != nil {
 		return 0, 0, err
 	}
-	if start < 0 || start > p.depth {
-		return 0, 0, p.newError("address must be between 0 and DEPTH")
+	if start == p.depth {
+		return 0, 0, p.newError("address must be between 0 and DEPTH-1")
 	}
 
 	if tok, err = p.expect([]Token{TokRange}); err != nil {
@@ -213,12 +292,15 @@ func (p *Parser) address() (int64, int64, error) {
 	if end, err = p.readAddress(); err != nil {
 		return 0, 0, err
 	}
-	if end < 0 || end > p.depth {
-		return 0, 0, p.newError("address must be between 0 and DEPTH")
-	}
 	if end <= start {
 		return 0, 0, p.newError("end address in range must be greater than start")
 	}
+	if end == p.depth {
+		// a common mistake, as the last address is DEPTH-1
+		p.warn(fmt.Sprintf("range ends at DEPTH (%d), the last address is %d",
+			p.depth, p.depth-1))
+		end--
+	}
 
 	if tok, err = p.expect([]Token{TokClose}); err != nil {
 		return 0, 0, err
@@ -227,35 +309,61 @@ func (p *Parser) address() (int64, int64, error) {
 	return start, end, err
 }
 
-// value -> TokNumber opt_itervalue
-// opt_itervalue -> TokNumber opt_itervalue | eps
-func (p *Parser) value() ([]int64, error) {
+// value -> number opt_itervalue
+// opt_itervalue -> number opt_itervalue | eps
+// number -> TokNumber | TokIdent
+func (p *Parser) value() ([]uint64, error) {
 	var err error
 
-	if _, err = p.expect([]Token{TokNumber}); err != nil {
+	if _, err = p.expect(numberTokens); err != nil {
 		return nil, err
 	}
 
-	ret := make([]int64, 1)
-	if ret[0], err = p.readWithFormat(p.l.GetData(), p.dataFormat); err != nil {
+	// values are appended to the arena and returned as a slice of it, the
+	// arena growing does not change the slices returned before
+	start := len(p.arena)
+
+	v, err := p.readWithFormat(p.l.GetBytes(), p.dataFormat, p.width)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.checkStored(1); err != nil {
 		return nil, err
 	}
+	p.arena = append(p.arena, v)
 
 	for {
 		tok, err := p.l.NextToken()
 		if err != nil {
+			p.arena = p.arena[:start]
 			return nil, err
 		}
-		if tok != TokNumber {
+		if tok != TokNumber && tok != TokIdent {
 			p.l.UnReadToken()
 			break
 		}
-		v, err := p.readWithFormat(p.l.GetData(), p.dataFormat)
+		v, err := p.readWithFormat(p.l.GetBytes(), p.dataFormat, p.width)
 		if err != nil {
+			p.arena = p.arena[:start]
 			return nil, err
 		}
-		ret = append(ret, v)
+		if err = p.checkStored(int64(len(p.arena) - start + 1)); err != nil {
+			return nil, err
+		}
+		p.arena = append(p.arena, v)
 	}
 
-	return ret, nil
+	n := len(p.arena) - start
+	p.stored += int64(n)
+	return p.arena[start : start+n : start+n], nil
+}
+
+// checkStored returns an error that stops parsing if storing n more values
+// would exceed the limits.
+func (p *Parser) checkStored(n int64) error {
+	if p.limits.MaxValues == 0 || p.stored+n <= p.limits.MaxValues {
+		return nil
+	}
+	return p.fatal(fmt.Sprintf("the content has more than the limit of %d values",
+		p.limits.MaxValues))
 }
@@ -0,0 +1,122 @@
+package MIF
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestErrorRecovery(t *testing.T) {
+	src := `WIDTH=8;
+DEPTH=8;
+ADDRESS_RADIX=UNS;
+DATA_RADIX=UNS;
+CONTENT BEGIN
+0:1;
+1:300;
+2 3;
+3:4;
+[5..4]:1;
+9:1;
+6:$;
+7:7;
+END;
+`
+	p := NewParser(strings.NewReader(src))
+	err := p.Parse()
+
+	el, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("got error %v, want an ErrorList", err)
+	}
+
+	wantLines := []int{7, 8, 10, 11, 12}
+	var lines []int
+	for _, e := range el {
+		if e.Severity() == SeverityError {
+			l, _ := e.Position()
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) != len(wantLines) {
+		t.Fatalf("got errors at lines %v, want %v:\n%v", lines, wantLines, err)
+	}
+	for i := range lines {
+		if lines[i] != wantLines[i] {
+			t.Fatalf("got errors at lines %v, want %v:\n%v", lines, wantLines, err)
+		}
+	}
+
+	// the valid definitions around the errors are still read
+	words := p.GetWords()
+	if words[0] != 1 || words[3] != 4 || words[7] != 7 {
+		t.Errorf("valid definitions not read: %v", words)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	src := `WIDTH=8;
+DEPTH=8;
+ADDRESS_RADIX=UNS;
+DATA_RADIX=UNS;
+CONTENT BEGIN
+[0..3]:1;
+2:2;
+[6..8]:3;
+END;
+`
+	p := NewParser(strings.NewReader(src))
+	if err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"address 2 was already defined", "range ends at DEPTH",
+		"2 addresses are never defined"}
+	warnings := p.GetErrors()
+	if len(warnings) != len(want) {
+		t.Fatalf("got warnings:\n%v", warnings)
+	}
+	for i, w := range warnings {
+		if w.Severity() != SeverityWarning || !strings.Contains(w.Error(), want[i]) {
+			t.Errorf("warning %d is %v, want %q", i, w, want[i])
+		}
+	}
+
+	if words := p.GetWords(); words[2] != 2 || words[7] != 3 {
+		t.Errorf("got words %v", words)
+	}
+}
+
+func TestHeaderErrors(t *testing.T) {
+	src := "WIDTH=8;\nDEPHT=8;\nADDRESS_RADIX=UNS;\nDATA_RADIX=XYZ;\nCONTENT BEGIN\nEND;\n"
+	err := NewParser(strings.NewReader(src)).Parse()
+
+	el, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("got error %v, want an ErrorList", err)
+	}
+	// the invalid identifier and format, plus the missing DEPTH and DATA_RADIX
+	if len(el) != 4 {
+		t.Errorf("got %d errors, want 4:\n%v", len(el), err)
+	}
+}
+
+func TestInvalidSize(t *testing.T) {
+	src := "DEPTH = abc;\nWIDTH = 16;\nWIDTH = 9999999999999999999;\n" +
+		"ADDRESS_RADIX = DEC;\nDATA_RADIX = XYZ;\nCONTENT BEGIN\nEND;\n"
+	err := NewParser(strings.NewReader(src)).Parse()
+
+	el, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("got error %v, want an ErrorList", err)
+	}
+	// both sizes and the format, plus the missing DEPTH and DATA_RADIX
+	if len(el) != 5 {
+		t.Fatalf("got %d errors, want 5:\n%v", len(el), err)
+	}
+	if el[0].line != 1 || !strings.Contains(el[0].cause, "invalid DEPTH abc") {
+		t.Errorf("got error %v, want an invalid DEPTH at line 1", el[0])
+	}
+	if el[1].line != 3 || !strings.Contains(el[1].cause, "invalid WIDTH") {
+		t.Errorf("got error %v, want an invalid WIDTH at line 3", el[1])
+	}
+}
@@ -0,0 +1,17 @@
+package assembler
+
+import "fmt"
+
+// AsmError denotes a lexer or assembler error at a certain position of an
+// assembly source file.
+type AsmError struct {
+	component string
+	line      int
+	col       int
+	cause     string
+}
+
+func (e AsmError) Error() string {
+	return fmt.Sprintf("%s failed at line %d, col %d: %s", e.component, e.line,
+		e.col, e.cause)
+}
@@ -0,0 +1,510 @@
+// package assembler implements an assembler for the ICMC architecture,
+// turning assembly source into the 16 bit words the processor executes.
+//
+// The syntax is the one accepted by the original ICMC assembler: one
+// statement per line, labels defined as "name:", comments starting with ';',
+// immediates prefixed by '#' (that may be numbers, 'c' character literals or
+// labels) and the directives "var #n", "static label + #offset, #value" and
+// "string "text"".
+package assembler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// memSize is the amount of words in the ICMC memory.
+const memSize = 1 << 15
+
+// operand is an immediate value that may refer to a label not yet defined.
+type operand struct {
+	value uint16
+	label string // if not empty, the value is the label address plus value
+	line  int
+	col   int
+}
+
+// fixup records a memory position whose value depends on a label.
+type fixup struct {
+	pos int
+	op  operand
+}
+
+// static records a static directive, which may refer to labels defined after
+// it in both the address and the value.
+type static struct {
+	addr  operand
+	value operand
+}
+
+// Assembler represents a complete assembler driver struct, with a Lexer and
+// the program being generated.
+type Assembler struct {
+	l *Lexer
+
+	words   []uint16
+	pc      int
+	labels  map[string]uint16
+	fixups  []fixup
+	statics []static
+}
+
+func NewAssembler(rd io.Reader) *Assembler {
+	return &Assembler{
+		l:      NewLexer(rd),
+		words:  make([]uint16, memSize),
+		labels: map[string]uint16{},
+	}
+}
+
+// Assemble reads a whole assembly program and returns the memory image with
+// 1 << 15 words that represents it.
+func Assemble(rd io.Reader) ([]uint16, error) {
+	a := NewAssembler(rd)
+	if err := a.Assemble(); err != nil {
+		return nil, err
+	}
+	return a.GetWords(), nil
+}
+
+// GetWords returns the memory image generated by Assemble.
+func (a *Assembler) GetWords() []uint16 {
+	return a.words
+}
+
+// GetLabels returns the address of every label defined in the program.
+func (a *Assembler) GetLabels() map[string]uint16 {
+	return a.labels
+}
+
+func (a *Assembler) newError(cause string) error {
+	l, c := a.l.GetPosition()
+	return AsmError{"assembler", l, c, cause}
+}
+
+// newErrorAt creates an error at a position other than the last token read.
+func (a *Assembler) newErrorAt(l, c int, cause string) error {
+	return AsmError{"assembler", l, c, cause}
+}
+
+// expect reads a single token, and if it is not in the list provided, returns
+// an error.
+func (a *Assembler) expect(expected []Token) (Token, error) {
+	tok, err := a.l.NextToken()
+	if err != nil {
+		return TokNone, err
+	}
+
+	for _, ex := range expected {
+		if tok == ex {
+			return tok, nil
+		}
+	}
+
+	a.l.UnReadToken()
+	return TokNone, a.newError(
+		fmt.Sprintf("unexpected token %v in input, wanted %v", tok, expected),
+	)
+}
+
+// Assemble reads every line of the program, and after that resolves all label
+// references.
+func (a *Assembler) Assemble() error {
+	for {
+		tok, err := a.l.NextToken()
+		if err != nil {
+			return err
+		}
+		if tok == TokEOF {
+			break
+		}
+		if tok == TokNewline {
+			continue
+		}
+
+		a.l.UnReadToken()
+		if err = a.line(); err != nil {
+			return err
+		}
+	}
+
+	for _, st := range a.statics {
+		addr, err := a.resolve(st.addr)
+		if err != nil {
+			return err
+		}
+		value, err := a.resolve(st.value)
+		if err != nil {
+			return err
+		}
+		if int(addr) >= memSize {
+			return a.newErrorAt(st.addr.line, st.addr.col,
+				"static address out of memory")
+		}
+		a.words[addr] = value
+	}
+
+	for _, f := range a.fixups {
+		v, err := a.resolve(f.op)
+		if err != nil {
+			return err
+		}
+		a.words[f.pos] = v
+	}
+
+	return nil
+}
+
+// resolve returns the final value of an operand, adding the label address.
+func (a *Assembler) resolve(op operand) (uint16, error) {
+	if op.label == "" {
+		return op.value, nil
+	}
+
+	addr, ok := a.labels[op.label]
+	if !ok {
+		return 0, a.newErrorAt(op.line, op.col,
+			fmt.Sprintf("undefined label %s", op.label))
+	}
+	return addr + op.value, nil
+}
+
+// emit writes a word at the current position and advances it.
+func (a *Assembler) emit(w uint16) error {
+	if a.pc >= memSize {
+		return a.newError("program does not fit in memory")
+	}
+	a.words[a.pc] = w
+	a.pc++
+	return nil
+}
+
+// emitOperand writes an operand at the current position, leaving a fixup if
+// it depends on a label.
+func (a *Assembler) emitOperand(op operand) error {
+	if op.label != "" {
+		a.fixups = append(a.fixups, fixup{a.pc, op})
+	}
+	return a.emit(op.value)
+}
+
+// line reads a whole line, with an optional label definition and an optional
+// statement.
+func (a *Assembler) line() error {
+	if _, err := a.expect([]Token{TokIdent}); err != nil {
+		return err
+	}
+	name := a.l.GetData()
+	l, c := a.l.GetPosition()
+
+	tok, err := a.l.NextToken()
+	if err != nil {
+		return err
+	}
+
+	if tok == TokColon {
+		if err = a.defineLabel(name, l, c); err != nil {
+			return err
+		}
+
+		// the label may be alone in it's line
+		if tok, err = a.l.NextToken(); err != nil {
+			return err
+		}
+		if tok == TokNewline || tok == TokEOF {
+			return nil
+		}
+		a.l.UnReadToken()
+
+		if _, err := a.expect([]Token{TokIdent}); err != nil {
+			return err
+		}
+		name = a.l.GetData()
+		l, c = a.l.GetPosition()
+	} else {
+		a.l.UnReadToken()
+	}
+
+	if err = a.statement(strings.ToLower(name), l, c); err != nil {
+		return err
+	}
+
+	_, err = a.expect([]Token{TokNewline, TokEOF})
+	return err
+}
+
+// defineLabel sets the address of a label, read at line l and column c, to
+// the current position.
+func (a *Assembler) defineLabel(name string, l, c int) error {
+	if _, ok := a.labels[name]; ok {
+		return a.newErrorAt(l, c, fmt.Sprintf("label %s defined more than once", name))
+	}
+	if _, ok := mnemonics[strings.ToLower(name)]; ok {
+		return a.newErrorAt(l, c,
+			fmt.Sprintf("label %s has the same name as an instruction", name))
+	}
+	a.labels[name] = uint16(a.pc)
+	return nil
+}
+
+// statement assembles a directive or instruction, whose name has already
+// been read at line l and column c.
+func (a *Assembler) statement(name string, l, c int) error {
+	switch name {
+	case "var":
+		return a.directiveVar()
+	case "static":
+		return a.directiveStatic()
+	case "string":
+		return a.directiveString()
+	}
+
+	enc, ok := mnemonics[name]
+	if !ok {
+		return a.newErrorAt(l, c, fmt.Sprintf("unknown instruction %s", name))
+	}
+	return a.instruction(enc)
+}
+
+// var -> TokIdent(var) immediate
+func (a *Assembler) directiveVar() error {
+	n, err := a.immediate()
+	if err != nil {
+		return err
+	}
+	if n.label != "" {
+		return a.newError("var size must be a number")
+	}
+	if a.pc+int(n.value) > memSize {
+		return a.newError("program does not fit in memory")
+	}
+
+	// reserved memory is zeroed, which is already the case
+	a.pc += int(n.value)
+	return nil
+}
+
+// static -> TokIdent(static) TokIdent [TokPlus immediate] TokComma immediate
+func (a *Assembler) directiveStatic() error {
+	if _, err := a.expect([]Token{TokIdent}); err != nil {
+		return err
+	}
+	l, c := a.l.GetPosition()
+	addr := operand{label: a.l.GetData(), line: l, col: c}
+
+	tok, err := a.l.NextToken()
+	if err != nil {
+		return err
+	}
+	if tok == TokPlus {
+		offset, err := a.immediate()
+		if err != nil {
+			return err
+		}
+		if offset.label != "" {
+			return a.newError("static offset must be a number")
+		}
+		addr.value = offset.value
+	} else {
+		a.l.UnReadToken()
+	}
+
+	if _, err = a.expect([]Token{TokComma}); err != nil {
+		return err
+	}
+
+	value, err := a.immediate()
+	if err != nil {
+		return err
+	}
+
+	a.statics = append(a.statics, static{addr, value})
+	return nil
+}
+
+// string -> TokIdent(string) TokString
+func (a *Assembler) directiveString() error {
+	if _, err := a.expect([]Token{TokString}); err != nil {
+		return err
+	}
+
+	// strings are stored one character per word, ending with a '\0'
+	for _, c := range []byte(a.l.GetData()) {
+		if err := a.emit(uint16(c)); err != nil {
+			return err
+		}
+	}
+	return a.emit(0)
+}
+
+// instruction assembles an instruction, reading it's operands based on the
+// form of the encoding.
+func (a *Assembler) instruction(enc encoding) error {
+	w := enc.word()
+
+	var err error
+	var r1, r2, r3 uint16
+	var imm operand
+
+	switch enc.form {
+	case FormNone:
+	case FormReg:
+		r1, err = a.register()
+		w |= r1 << 7
+	case FormReg2:
+		if r1, err = a.register(); err != nil {
+			return err
+		}
+		if err = a.comma(); err != nil {
+			return err
+		}
+		r2, err = a.register()
+		w |= r1<<7 | r2<<4
+	case FormReg3:
+		if r1, err = a.register(); err != nil {
+			return err
+		}
+		if err = a.comma(); err != nil {
+			return err
+		}
+		if r2, err = a.register(); err != nil {
+			return err
+		}
+		if err = a.comma(); err != nil {
+			return err
+		}
+		r3, err = a.register()
+		w |= r1<<7 | r2<<4 | r3<<1
+	case FormRegImm:
+		if r1, err = a.register(); err != nil {
+			return err
+		}
+		if err = a.comma(); err != nil {
+			return err
+		}
+		imm, err = a.immediate()
+		w |= r1 << 7
+	case FormImmReg:
+		if imm, err = a.immediate(); err != nil {
+			return err
+		}
+		if err = a.comma(); err != nil {
+			return err
+		}
+		r1, err = a.register()
+		w |= r1 << 7
+	case FormImm:
+		imm, err = a.immediate()
+	case FormRegOrFR:
+		if a.special("fr") {
+			w |= 1 << 6
+		} else {
+			r1, err = a.register()
+			w |= r1 << 7
+		}
+	case FormMov:
+		w, err = a.mov(w)
+	case FormRegShift:
+		if r1, err = a.register(); err != nil {
+			return err
+		}
+		if err = a.comma(); err != nil {
+			return err
+		}
+		if imm, err = a.immediate(); err != nil {
+			return err
+		}
+		if imm.label != "" || imm.value > 0b1111 {
+			return a.newError("shift amount must be a number between 0 and 15")
+		}
+		w |= r1<<7 | imm.value
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = a.emit(w); err != nil {
+		return err
+	}
+	if enc.size() == 2 {
+		return a.emitOperand(imm)
+	}
+	return nil
+}
+
+// mov -> register TokComma register | sp TokComma register |
+// register TokComma sp
+func (a *Assembler) mov(w uint16) (uint16, error) {
+	if a.special("sp") {
+		if err := a.comma(); err != nil {
+			return 0, err
+		}
+		r, err := a.register()
+		return w | r<<7 | 0b11, err
+	}
+
+	rd, err := a.register()
+	if err != nil {
+		return 0, err
+	}
+	if err = a.comma(); err != nil {
+		return 0, err
+	}
+
+	if a.special("sp") {
+		return w | rd<<7 | 0b01, nil
+	}
+
+	rs, err := a.register()
+	return w | rd<<7 | rs<<4, err
+}
+
+func (a *Assembler) comma() error {
+	_, err := a.expect([]Token{TokComma})
+	return err
+}
+
+// special reads an identifier if it is the special register name provided,
+// and returns if it was read.
+func (a *Assembler) special(name string) bool {
+	tok, err := a.l.NextToken()
+	if err == nil && tok == TokIdent && strings.ToLower(a.l.GetData()) == name {
+		return true
+	}
+	a.l.UnReadToken()
+	return false
+}
+
+// register -> TokIdent(r0 to r7)
+func (a *Assembler) register() (uint16, error) {
+	if _, err := a.expect([]Token{TokIdent}); err != nil {
+		return 0, err
+	}
+
+	r := strings.ToLower(a.l.GetData())
+	if len(r) != 2 || r[0] != 'r' || r[1] < '0' || r[1] > '7' {
+		return 0, a.newError(fmt.Sprintf("invalid register %s", a.l.GetData()))
+	}
+	return uint16(r[1] - '0'), nil
+}
+
+// immediate -> [TokHash] (TokNumber | TokChar | TokIdent)
+func (a *Assembler) immediate() (operand, error) {
+	tok, err := a.expect([]Token{TokHash, TokNumber, TokChar, TokIdent})
+	if err != nil {
+		return operand{}, err
+	}
+	if tok == TokHash {
+		tok, err = a.expect([]Token{TokNumber, TokChar, TokIdent})
+		if err != nil {
+			return operand{}, err
+		}
+	}
+
+	l, c := a.l.GetPosition()
+	if tok == TokIdent {
+		return operand{label: a.l.GetData(), line: l, col: c}, nil
+	}
+	return operand{value: uint16(a.l.GetNumber()), line: l, col: c}, nil
+}
@@ -0,0 +1,191 @@
+package assembler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+)
+
+// word returns an instruction word with an opcode and the other bits set.
+func word(op processor.Opcode, bits uint16) uint16 {
+	return uint16(op)<<10 | bits
+}
+
+// assemble assembles a source, failing the test on errors.
+func assemble(t *testing.T, src string) *Assembler {
+	t.Helper()
+
+	a := NewAssembler(strings.NewReader(src))
+	if err := a.Assemble(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return a
+}
+
+// checkWords compares the start of a memory image with the words expected.
+func checkWords(t *testing.T, got, want []uint16) {
+	t.Helper()
+
+	for i, w := range want {
+		if got[i] != w {
+			t.Errorf("word %d = %016b, want %016b", i, got[i], w)
+		}
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		want   []uint16
+		labels map[string]uint16
+	}{
+		{
+			name:   "var",
+			src:    "a: var #3\nb: var 1\nhalt\n",
+			want:   []uint16{0, 0, 0, 0, word(processor.OpHALT, 0)},
+			labels: map[string]uint16{"a": 0, "b": 3},
+		},
+		{
+			name: "static",
+			src: "x: var #2\nstatic x + #1, #'A'\nstatic x, #y\n" +
+				"y: nop ; static values may use labels defined later\n",
+			want:   []uint16{2, 'A', word(processor.OpNOP, 0)},
+			labels: map[string]uint16{"x": 0, "y": 2},
+		},
+		{
+			name:   "string",
+			src:    "s: string \"h\\ti\\n\\\"\"\nend: halt\n",
+			want:   []uint16{'h', '\t', 'i', '\n', '"', 0, word(processor.OpHALT, 0)},
+			labels: map[string]uint16{"s": 0, "end": 6},
+		},
+		{
+			name:   "label alone in a line",
+			src:    "\n; comment\nstart:\n\n  nop\n",
+			want:   []uint16{word(processor.OpNOP, 0)},
+			labels: map[string]uint16{"start": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assemble(t, tt.src)
+			checkWords(t, a.GetWords(), tt.want)
+
+			labels := a.GetLabels()
+			if len(labels) != len(tt.labels) {
+				t.Errorf("labels %v, want %v", labels, tt.labels)
+			}
+			for name, addr := range tt.labels {
+				if labels[name] != addr {
+					t.Errorf("label %s at %d, want %d", name, labels[name], addr)
+				}
+			}
+		})
+	}
+}
+
+func TestOperandForms(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []uint16
+	}{
+		// FormNone
+		{"halt", []uint16{word(processor.OpHALT, 0)}},
+		{"SETC", []uint16{word(processor.OpCSCARRY, 1<<9)}},
+		// FormReg
+		{"inc r5", []uint16{word(processor.OpINCDEC, 5<<7)}},
+		{"dec R5", []uint16{word(processor.OpINCDEC, 5<<7|1<<6)}},
+		// FormReg2
+		{"not r1, r2", []uint16{word(processor.OpNOT, 1<<7|2<<4)}},
+		{"outchar r7, r0", []uint16{word(processor.OpOUTCHAR, 7<<7)}},
+		// FormReg3
+		{"add r1, r2, r3", []uint16{word(processor.OpADD, 1<<7|2<<4|3<<1)}},
+		{"subc r7,r6,r5", []uint16{word(processor.OpSUB, 7<<7|6<<4|5<<1|1)}},
+		// FormRegImm, with every kind of immediate
+		{"loadn r1, #10", []uint16{word(processor.OpLOADN, 1<<7), 10}},
+		{"loadn r1, 0x1f", []uint16{word(processor.OpLOADN, 1<<7), 0x1f}},
+		{"loadn r1, #0b101", []uint16{word(processor.OpLOADN, 1<<7), 5}},
+		{"loadn r1, #0o17", []uint16{word(processor.OpLOADN, 1<<7), 15}},
+		{"loadn r1, #'\\n'", []uint16{word(processor.OpLOADN, 1<<7), '\n'}},
+		{"l: loadn r1, #l", []uint16{word(processor.OpLOADN, 1<<7), 0}},
+		{"load r2, 300", []uint16{word(processor.OpLOAD, 2<<7), 300}},
+		// FormImmReg
+		{"store 300, r2", []uint16{word(processor.OpSTORE, 2<<7), 300}},
+		// FormImm
+		{"jmp end\nend: halt", []uint16{word(processor.OpJMP, 0), 2}},
+		{"jz 7", []uint16{word(processor.OpJMP, 3<<6), 7}},
+		{"cdz 7", []uint16{word(processor.OpCALL, 14<<6), 7}},
+		// FormRegOrFR
+		{"push r3", []uint16{word(processor.OpPUSH, 3<<7)}},
+		{"pop FR", []uint16{word(processor.OpPOP, 1<<6)}},
+		// FormMov
+		{"mov r1, r2", []uint16{word(processor.OpMOV, 1<<7|2<<4)}},
+		{"mov r1, sp", []uint16{word(processor.OpMOV, 1<<7|0b01)}},
+		{"mov sp, r1", []uint16{word(processor.OpMOV, 1<<7|0b11)}},
+		// FormRegShift
+		{"shiftl0 r1, #3", []uint16{word(processor.OpROTSH, 1<<7|3)}},
+		{"rotr r4, #15", []uint16{word(processor.OpROTSH, 4<<7|6<<4|15)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			checkWords(t, assemble(t, tt.src).GetWords(), tt.want)
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		component string
+		line, col int
+		cause     string
+	}{
+		{"unknown instruction", "nop\nfoo r1\n", "assembler", 2, 1,
+			"unknown instruction foo"},
+		{"invalid register", "add r1, r2, r8\n", "assembler", 1, 13,
+			"invalid register r8"},
+		{"missing comma", "loadn r1 #1\n", "assembler", 1, 10,
+			"unexpected token '#' in input, wanted [',']"},
+		{"extra operand", "halt r1\n", "assembler", 1, 6,
+			"unexpected token identifier in input, wanted [end of line EOF]"},
+		{"undefined label", "\n  jmp nowhere\n", "assembler", 2, 7,
+			"undefined label nowhere"},
+		{"undefined static label", "static x, #1\n", "assembler", 1, 8,
+			"undefined label x"},
+		{"repeated label", "a: nop\na: nop\n", "assembler", 2, 1,
+			"label a defined more than once"},
+		{"label named as instruction", "Inc: nop\n", "assembler", 1, 1,
+			"label Inc has the same name as an instruction"},
+		{"var with a label", "var #x\n", "assembler", 1, 6,
+			"var size must be a number"},
+		{"var too big", "nop\nvar #32768\n", "assembler", 2, 6,
+			"program does not fit in memory"},
+		{"shift too big", "shiftl0 r1, #16\n", "assembler", 1, 14,
+			"shift amount must be a number between 0 and 15"},
+		{"invalid number", "loadn r0, #70000\n", "lexer", 1, 17,
+			"invalid number 70000"},
+		{"long character", "loadn r0, #'ab'\n", "lexer", 1, 15,
+			"expected ' to end character literal"},
+		{"invalid character", "nop\n  nop $\n", "lexer", 2, 8,
+			"invalid character $ in input"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Assemble(strings.NewReader(tt.src))
+			got, ok := err.(AsmError)
+			if !ok {
+				t.Fatalf("error %v, want an AsmError", err)
+			}
+
+			want := AsmError{tt.component, tt.line, tt.col, tt.cause}
+			if got != want {
+				t.Errorf("error %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package assembler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+)
+
+// Form defines the operands an instruction mnemonic takes, and therefore how
+// they are encoded in the instruction word(s).
+type Form int
+
+const (
+	FormNone     Form = iota // no operands
+	FormReg                  // rx, register at bit 7
+	FormReg2                 // rx, ry, registers at bits 7 and 4
+	FormReg3                 // rx, ry, rz, registers at bits 7, 4 and 1
+	FormRegImm               // rx, #imm, register at bit 7 and a second word
+	FormImmReg               // #imm, rx, same encoding as FormRegImm
+	FormImm                  // #imm, only a second word
+	FormRegOrFR              // rx or fr, register at bit 7 or bit 6 set for fr
+	FormMov                  // rx, ry or sp, rx or rx, sp
+	FormRegShift             // rx, #n, register at bit 7 and n at bits 0 to 3
+)
+
+// encoding describes how a single mnemonic is turned into an instruction.
+type encoding struct {
+	op   processor.Opcode
+	bits uint16 // bits other than the opcode always set for this mnemonic
+	form Form
+}
+
+// size returns the number of words the instruction occupies in memory.
+func (e encoding) size() int {
+	switch e.form {
+	case FormRegImm, FormImmReg, FormImm:
+		return 2
+	}
+	return 1
+}
+
+// word returns the first instruction word, without any operands.
+func (e encoding) word() uint16 {
+	return uint16(e.op)<<10 | e.bits
+}
+
+// condSuffixes are the branch condition suffixes for jumps and calls, indexed
+// by their sub opcode. They must match the ones the processor disassembles.
+var condSuffixes = []string{
+	"", "eq", "ne", "z", "nz", "c", "nc", "gr",
+	"le", "eg", "el", "ov", "nov", "n", "dz",
+}
+
+// mnemonics maps every mnemonic accepted by the assembler (in lower case) to
+// it's encoding. Jumps and calls are added by init, and extensions by
+// RegisterMnemonic.
+var mnemonics = map[string]encoding{
+	"add":     {processor.OpADD, 0, FormReg3},
+	"addc":    {processor.OpADD, 1, FormReg3},
+	"sub":     {processor.OpSUB, 0, FormReg3},
+	"subc":    {processor.OpSUB, 1, FormReg3},
+	"mult":    {processor.OpMULT, 0, FormReg3},
+	"multc":   {processor.OpMULT, 1, FormReg3},
+	"mul":     {processor.OpMULT, 0, FormReg3},
+	"mulc":    {processor.OpMULT, 1, FormReg3},
+	"div":     {processor.OpDIV, 0, FormReg3},
+	"divc":    {processor.OpDIV, 1, FormReg3},
+	"mod":     {processor.OpMOD, 0, FormReg3},
+	"and":     {processor.OpAND, 0, FormReg3},
+	"or":      {processor.OpOR, 0, FormReg3},
+	"xor":     {processor.OpXOR, 0, FormReg3},
+	"not":     {processor.OpNOT, 0, FormReg2},
+	"inc":     {processor.OpINCDEC, 0, FormReg},
+	"dec":     {processor.OpINCDEC, 1 << 6, FormReg},
+	"cmp":     {processor.OpCMP, 0, FormReg2},
+	"shiftl0": {processor.OpROTSH, 0 << 4, FormRegShift},
+	"shiftl1": {processor.OpROTSH, 1 << 4, FormRegShift},
+	"shiftr0": {processor.OpROTSH, 2 << 4, FormRegShift},
+	"shiftr1": {processor.OpROTSH, 3 << 4, FormRegShift},
+	"rotl":    {processor.OpROTSH, 4 << 4, FormRegShift},
+	"rotr":    {processor.OpROTSH, 6 << 4, FormRegShift},
+	"mov":     {processor.OpMOV, 0, FormMov},
+	"push":    {processor.OpPUSH, 0, FormRegOrFR},
+	"pop":     {processor.OpPOP, 0, FormRegOrFR},
+	"loadn":   {processor.OpLOADN, 0, FormRegImm},
+	"load":    {processor.OpLOAD, 0, FormRegImm},
+	"store":   {processor.OpSTORE, 0, FormImmReg},
+	"loadi":   {processor.OpLOADI, 0, FormReg2},
+	"storei":  {processor.OpSTOREI, 0, FormReg2},
+	"rts":     {processor.OpRTS, 0, FormNone},
+	"inchar":  {processor.OpINCHAR, 0, FormReg},
+	"outchar": {processor.OpOUTCHAR, 0, FormReg2},
+	"halt":    {processor.OpHALT, 0, FormNone},
+	"breakp":  {processor.OpBREAKP, 0, FormNone},
+	"nop":     {processor.OpNOP, 0, FormNone},
+	"setc":    {processor.OpCSCARRY, 1 << 9, FormNone},
+	"clearc":  {processor.OpCSCARRY, 0, FormNone},
+	"ei":      {processor.OpEIDI, 1 << 9, FormNone},
+	"di":      {processor.OpEIDI, 0, FormNone},
+	"reti":    {processor.OpRETI, 0, FormNone},
+	"setiv":   {processor.OpSETIV, 0, FormReg},
+}
+
+func init() {
+	// jmp and call are the unconditional versions, all others are j or c
+	// followed by the condition suffix.
+	mnemonics["jmp"] = encoding{processor.OpJMP, 0, FormImm}
+	mnemonics["call"] = encoding{processor.OpCALL, 0, FormImm}
+
+	for i, cond := range condSuffixes[1:] {
+		sub := uint16(i+1) << 6
+		mnemonics["j"+cond] = encoding{processor.OpJMP, sub, FormImm}
+		mnemonics["c"+cond] = encoding{processor.OpCALL, sub, FormImm}
+	}
+}
+
+// RegisterMnemonic makes the assembler accept a mnemonic for an instruction
+// added with processor.RegisterInstruction or RegisterSubInstruction, encoded
+// with it's opcode, the bits other than the opcode always set (such as the
+// ones telling sub instructions apart) and the form of it's operands. It
+// fails if the mnemonic or directive already exists. Mnemonics must not be
+// registered while a program is being assembled.
+func RegisterMnemonic(name string, op processor.Opcode, bits uint16, form Form) error {
+	name = strings.ToLower(name)
+	if name == "" {
+		return fmt.Errorf("empty mnemonic")
+	}
+	for i := 0; i < len(name); i++ {
+		if !isIdentByte(name[i]) || (i == 0 && name[i] >= '0' && name[i] <= '9') {
+			return fmt.Errorf("invalid mnemonic %s", name)
+		}
+	}
+	switch name {
+	case "var", "static", "string":
+		return fmt.Errorf("mnemonic %s is a directive", name)
+	}
+	if _, ok := mnemonics[name]; ok {
+		return fmt.Errorf("mnemonic %s is already defined", name)
+	}
+
+	if op >= 64 {
+		return fmt.Errorf("invalid opcode %d", op)
+	}
+	if bits>>10 != 0 {
+		return fmt.Errorf("bits %016b of %s overlap the opcode", bits, name)
+	}
+	if form < FormNone || form > FormRegShift {
+		return fmt.Errorf("invalid form %d for %s", form, name)
+	}
+
+	mnemonics[name] = encoding{op, bits, form}
+	return nil
+}
+
+// UnregisterMnemonic removes a mnemonic from the assembler, built in or
+// registered.
+func UnregisterMnemonic(name string) error {
+	name = strings.ToLower(name)
+	if _, ok := mnemonics[name]; !ok {
+		return fmt.Errorf("no mnemonic %s", name)
+	}
+	delete(mnemonics, name)
+	return nil
+}
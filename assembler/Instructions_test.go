@@ -0,0 +1,101 @@
+package assembler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+)
+
+// execINCMOD is the example instruction of the documentation, rx = (rx+1)%ry.
+func execINCMOD(pr *processor.ICMCProcessor) error {
+	inst := pr.Data[pr.PC]
+	rx, ry := processor.RegAt(inst, 7), processor.RegAt(inst, 4)
+	pr.GPRRegs[rx] = (pr.GPRRegs[rx] + 1) % pr.GPRRegs[ry]
+	return nil
+}
+
+const opINCMOD = 0b111111
+
+func TestRegisterMnemonic(t *testing.T) {
+	const src = "loadn r0, #4\nloadn r1, #5\nINCMOD r0, r1\nincmod r0, r1\nhalt\n"
+
+	if _, err := Assemble(strings.NewReader(src)); err == nil {
+		t.Fatalf("unregistered mnemonic assembled")
+	}
+
+	err := processor.RegisterInstruction(processor.Instruction{
+		Op:          opINCMOD,
+		GenMnemonic: processor.RegMnemonic("incmod", 2),
+		Size:        1,
+		Cycles:      3,
+		Execute:     execINCMOD,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer processor.UnregisterInstruction(opINCMOD)
+
+	if err := RegisterMnemonic("incmod", opINCMOD, 0, FormReg2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer UnregisterMnemonic("incmod")
+
+	words, err := Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkWords(t, words[4:6], []uint16{word(opINCMOD, 1<<4), word(opINCMOD, 1<<4)})
+
+	pr := processor.NewEmptyProcessor(nil, nil)
+	copy(pr.Code[:], words)
+	pr.Reset()
+	var period time.Duration
+	if err := pr.RunUntilHalt(&period); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pr.GPRRegs[0] != 1 {
+		t.Errorf("r0 = %d after two incmod, want 1", pr.GPRRegs[0])
+	}
+
+	// a registered mnemonic is an instruction like the built in ones
+	if _, err := Assemble(strings.NewReader("incmod: halt\n")); err == nil {
+		t.Errorf("label with the name of a registered mnemonic accepted")
+	}
+
+	invalid := []struct {
+		name string
+		bits uint16
+		form Form
+	}{
+		{"incmod", 0, FormReg2},
+		{"ADD", 0, FormReg3},
+		{"string", 0, FormNone},
+		{"", 0, FormNone},
+		{"2x", 0, FormNone},
+		{"in-mod", 0, FormNone},
+		{"incmod2", 1 << 10, FormReg2},
+		{"incmod2", 0, FormRegShift + 1},
+	}
+	for _, in := range invalid {
+		if err := RegisterMnemonic(in.name, opINCMOD, in.bits, in.form); err == nil {
+			UnregisterMnemonic(in.name)
+			t.Errorf("mnemonic %q with bits %016b and form %d registered",
+				in.name, in.bits, in.form)
+		}
+	}
+	if err := RegisterMnemonic("incmod2", 64, 0, FormReg2); err == nil {
+		t.Errorf("mnemonic with an invalid opcode registered")
+	}
+
+	if err := UnregisterMnemonic("incmod"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := UnregisterMnemonic("incmod"); err == nil {
+		t.Errorf("mnemonic unregistered twice")
+	}
+	if _, err := Assemble(strings.NewReader(src)); err == nil {
+		t.Errorf("unregistered mnemonic assembled")
+	}
+}
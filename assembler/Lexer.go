@@ -0,0 +1,260 @@
+package assembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Lexer defines an ICMC assembly lexer, reading tokens one at a time.
+type Lexer struct {
+	stream   *bufio.Reader
+	line     int
+	col      int
+	tokLine  int // line where the last token read starts
+	tokCol   int // column where the last token read starts
+	lastTok  Token
+	rewinded bool
+
+	dataValue   string // used to store identifier and string contents when read
+	numberValue int64  // used to store numbers and characters when read
+}
+
+func NewLexer(rd io.Reader) *Lexer {
+	bufrd := bufio.NewReader(rd)
+	return &Lexer{stream: bufrd, line: 1, col: 1}
+}
+
+func (l *Lexer) GetData() string {
+	return l.dataValue
+}
+
+func (l *Lexer) GetNumber() int64 {
+	return l.numberValue
+}
+
+// GetPosition returns the position where the last token read starts.
+func (l *Lexer) GetPosition() (int, int) {
+	return l.tokLine, l.tokCol
+}
+
+func (l *Lexer) newError(cause string) error {
+	return AsmError{"lexer", l.line, l.col, cause}
+}
+
+func (l *Lexer) readByte() (byte, error) {
+	c, err := l.stream.ReadByte()
+	if err != nil {
+		return byte('\x00'), err
+	}
+	if c == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return c, nil
+}
+
+// unreadByte puts back the last byte read, which must not be a newline.
+func (l *Lexer) unreadByte() error {
+	l.col--
+	return l.stream.UnreadByte()
+}
+
+// peekByte returns the next byte in the stream without consuming it.
+func (l *Lexer) peekByte() (byte, error) {
+	b, err := l.stream.Peek(1)
+	if err != nil {
+		return byte('\x00'), err
+	}
+	return b[0], nil
+}
+
+func isIdentByte(c byte) bool {
+	return unicode.IsLetter(rune(c)) || unicode.IsNumber(rune(c)) || c == '_'
+}
+
+func (l *Lexer) readIdent() (err error) {
+	var c byte
+	var b strings.Builder
+
+	for {
+		if c, err = l.peekByte(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			break
+		}
+		if !isIdentByte(c) {
+			break
+		}
+
+		l.readByte()
+		b.WriteByte(c)
+	}
+
+	l.dataValue = b.String()
+	return
+}
+
+// readEscaped reads a single, possibly escaped, character inside a string or
+// character literal delimited by quote. It returns true if the closing quote
+// was read instead.
+func (l *Lexer) readEscaped(quote byte) (byte, bool, error) {
+	c, err := l.readByte()
+	if err == io.EOF || c == '\n' {
+		return 0, false, l.newError("unterminated literal")
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if c == quote {
+		return 0, true, nil
+	}
+	if c != '\\' {
+		return c, false, nil
+	}
+
+	if c, err = l.readByte(); err != nil {
+		return 0, false, l.newError("unterminated literal")
+	}
+
+	switch c {
+	case 'n':
+		return '\n', false, nil
+	case 't':
+		return '\t', false, nil
+	case 'r':
+		return '\r', false, nil
+	case '0':
+		return 0, false, nil
+	case '\\', '\'', '"':
+		return c, false, nil
+	}
+
+	return 0, false, l.newError(fmt.Sprintf("invalid escape sequence \\%c", c))
+}
+
+// nextToken reads the next token in the stream regardless if the lexer was
+// just unread or not. This version does not handle TokEOF, instead it returns
+// an io.EOF error.
+//
+// This is an internal function used by it's public version.
+func (l *Lexer) nextToken() (Token, error) {
+	var err error
+
+	// ignore whitespaces, except for newlines that end statements
+	c := byte(' ')
+	for c != '\n' && unicode.IsSpace(rune(c)) {
+		l.tokLine, l.tokCol = l.line, l.col
+		c, err = l.readByte()
+		if err != nil {
+			return TokNone, err
+		}
+	}
+
+	// if we found an identifier or number, read it
+	if isIdentByte(c) {
+		if err = l.unreadByte(); err != nil {
+			return TokNone, err
+		}
+		if err = l.readIdent(); err != nil {
+			return TokNone, err
+		}
+
+		if !unicode.IsNumber(rune(c)) {
+			return TokIdent, nil
+		}
+
+		// numbers can be decimal or have a 0x, 0o or 0b prefix
+		v, err := strconv.ParseUint(l.dataValue, 0, 16)
+		if err != nil {
+			return TokNone, l.newError(fmt.Sprintf("invalid number %s", l.dataValue))
+		}
+		l.numberValue = int64(v)
+		return TokNumber, nil
+	}
+
+	switch c {
+	case ';':
+		// ; starts a comment until the end of the line
+		for c != '\n' {
+			if c, err = l.readByte(); err != nil {
+				return TokNone, err
+			}
+		}
+		return TokNewline, nil
+	case '\n':
+		return TokNewline, nil
+	case ',':
+		return TokComma, nil
+	case ':':
+		return TokColon, nil
+	case '#':
+		return TokHash, nil
+	case '+':
+		return TokPlus, nil
+	case '\'':
+		v, end, err := l.readEscaped('\'')
+		if err != nil {
+			return TokNone, err
+		}
+		if end {
+			return TokNone, l.newError("empty character literal")
+		}
+		if _, end, err = l.readEscaped('\''); err != nil {
+			return TokNone, err
+		}
+		if !end {
+			return TokNone, l.newError("expected ' to end character literal")
+		}
+		l.numberValue = int64(v)
+		return TokChar, nil
+	case '"':
+		var b strings.Builder
+		for {
+			v, end, err := l.readEscaped('"')
+			if err != nil {
+				return TokNone, err
+			}
+			if end {
+				break
+			}
+			b.WriteByte(v)
+		}
+		l.dataValue = b.String()
+		return TokString, nil
+	}
+
+	return TokNone, l.newError(fmt.Sprintf("invalid character %c in input", c))
+}
+
+// NextToken reads a single token from the stream, and re-reads the last token
+// if the lexer was unread in the last reading.
+func (l *Lexer) NextToken() (Token, error) {
+	if l.rewinded {
+		l.rewinded = false
+		return l.lastTok, nil
+	}
+
+	tok, err := l.nextToken()
+	if err == io.EOF {
+		tok = TokEOF
+		err = nil
+	}
+
+	l.lastTok = tok
+
+	return tok, err
+}
+
+// UnReadToken undoes a token reading, putting it back in the input.
+// Much like getchar in C, it can only handle a single token unreading.
+// Calling it more than once without a reading is the same as calling it once.
+func (l *Lexer) UnReadToken() {
+	l.rewinded = true
+}
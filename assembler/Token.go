@@ -0,0 +1,42 @@
+package assembler
+
+import "fmt"
+
+// Token identifies a single syntatical unit in an ICMC assembly program.
+type Token byte
+
+const (
+	TokNone Token = iota // for errors
+	TokEOF
+	TokNewline
+	TokIdent
+	TokNumber
+	TokChar
+	TokString
+	TokComma
+	TokColon
+	TokHash
+	TokPlus
+)
+
+var TokMap = map[Token]string{
+	TokNone:    "<TokNone>",
+	TokEOF:     "EOF",
+	TokNewline: "end of line",
+	TokIdent:   "identifier",
+	TokNumber:  "number",
+	TokChar:    "character literal",
+	TokString:  "string",
+	TokComma:   "','",
+	TokColon:   "':'",
+	TokHash:    "'#'",
+	TokPlus:    "'+'",
+}
+
+func (tok Token) String() string {
+	s, ok := TokMap[tok]
+	if !ok {
+		return fmt.Sprintf("(unknown token %d)", int(tok))
+	}
+	return s
+}
@@ -0,0 +1,198 @@
+package devices
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// players are the commands that can play raw samples from their standard
+// input, tried in order.
+var players = [][]string{
+	{"aplay", "-q", "-t", "raw", "-f", "S16_LE", "-c", "1", "-r", fmt.Sprint(SampleRate), "-"},
+	{"paplay", "--raw", "--format=s16le", "--channels=1",
+		fmt.Sprintf("--rate=%d", SampleRate)},
+}
+
+const (
+	hostTick    = 10 * time.Millisecond  // how often samples are sent to the player
+	hostLatency = 100 * time.Millisecond // how far ahead of real time they are sent
+	maxAhead    = time.Second            // how far ahead notes can be scheduled
+)
+
+// HostPlayer plays notes through the sound system of the host, by piping
+// their samples to a command line player. Samples are sent in real time,
+// with silence between notes, so notes keep the time between their Start as
+// in WriteWAV. If the simulation runs faster or slower than ToneClock, the
+// notes are moved to play as soon as they arrive.
+type HostPlayer struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+
+	mu    sync.Mutex
+	sched scheduler
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewHostPlayer starts a player, failing if none is installed.
+func NewHostPlayer() (*HostPlayer, error) {
+	for _, args := range players {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+
+		cmd := exec.Command(args[0], args[1:]...)
+		in, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err = cmd.Start(); err != nil {
+			return nil, err
+		}
+
+		p := &HostPlayer{cmd: cmd, in: in, stop: make(chan struct{}),
+			done: make(chan struct{})}
+		go p.run()
+		return p, nil
+	}
+	return nil, fmt.Errorf("no sound player found, install aplay or paplay")
+}
+
+// run sends the samples of the notes scheduled to the player every hostTick,
+// up to hostLatency after the current time, until stopped or the player
+// stops.
+func (p *HostPlayer) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(hostTick)
+	defer ticker.Stop()
+
+	begin := time.Now()
+	var buf []int16
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		n := samplesIn(time.Since(begin)+hostLatency) - p.sched.pos
+		if n > 0 {
+			buf = p.sched.render(buf[:0], n)
+		}
+		p.mu.Unlock()
+
+		if n > 0 && binary.Write(p.in, binary.LittleEndian, buf) != nil {
+			return
+		}
+	}
+}
+
+// Play schedules a note to be played. It never blocks, so that it can be
+// used as a Tone's OnPlay.
+func (p *HostPlayer) Play(n Note) {
+	p.mu.Lock()
+	p.sched.add(n)
+	p.mu.Unlock()
+}
+
+// Close stops the player, cutting the notes still playing.
+func (p *HostPlayer) Close() error {
+	close(p.stop)
+	<-p.done
+	p.in.Close()
+	return p.cmd.Wait()
+}
+
+// scheduler places notes in a stream of samples and renders it. The Start of
+// a note is moved by shift to the stream time, which is adjusted when notes
+// arrive too late or too early to be played at that time.
+type scheduler struct {
+	started bool
+	shift   time.Duration
+	pos     int    // the samples rendered
+	notes   []Note // in stream time and in order, the first may be playing
+}
+
+// durationOf returns the time a number of samples takes.
+func durationOf(samples int) time.Duration {
+	return time.Duration(samples/SampleRate)*time.Second +
+		time.Duration(samples%SampleRate)*time.Second/SampleRate
+}
+
+// add schedules a note. Notes that would start before the samples already
+// rendered start right after them, and ones more than maxAhead after that
+// are brought closer, moving the notes after them by as much. A note
+// supersedes the ones scheduled to start at the same time or after it.
+func (s *scheduler) add(n Note) {
+	now := durationOf(s.pos)
+	if !s.started {
+		s.started = true
+		s.shift = now - n.Start
+	}
+
+	start := n.Start + s.shift
+	if start < now {
+		s.shift += now - start
+		start = now
+	} else if start > now+maxAhead {
+		s.shift -= start - now - maxAhead
+		start = now + maxAhead
+	}
+
+	i := len(s.notes)
+	for i > 0 && s.notes[i-1].Start >= start {
+		i--
+	}
+	n.Start = start
+	s.notes = append(s.notes[:i], n)
+}
+
+// end returns the sample the scheduled note i ends at, cut by the next one.
+func (s *scheduler) end(i int) int {
+	end := samplesIn(s.notes[i].Start + s.notes[i].Duration)
+	if i+1 < len(s.notes) {
+		if next := samplesIn(s.notes[i+1].Start); next < end {
+			end = next
+		}
+	}
+	return end
+}
+
+// render appends the next n samples of the stream to buf, discarding the
+// notes that ended.
+func (s *scheduler) render(buf []int16, n int) []int16 {
+	last := s.pos + n
+	for s.pos < last {
+		for len(s.notes) != 0 && s.end(0) <= s.pos {
+			s.notes = s.notes[1:]
+		}
+
+		until := last
+		if len(s.notes) == 0 || samplesIn(s.notes[0].Start) > s.pos {
+			// silence until the next note
+			if len(s.notes) != 0 && samplesIn(s.notes[0].Start) < until {
+				until = samplesIn(s.notes[0].Start)
+			}
+			for ; s.pos < until; s.pos++ {
+				buf = append(buf, 0)
+			}
+			continue
+		}
+
+		note, start := s.notes[0], samplesIn(s.notes[0].Start)
+		if end := s.end(0); end < until {
+			until = end
+		}
+		for ; s.pos < until; s.pos++ {
+			buf = append(buf, sample(note, int64(s.pos-start)))
+		}
+	}
+	return buf
+}
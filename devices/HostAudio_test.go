@@ -0,0 +1,73 @@
+package devices
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerCut(t *testing.T) {
+	var s scheduler
+
+	// a note 2s into the program starts right away, and is cut after 5ms by
+	// a rest that lasts until after the end
+	s.add(Note{Start: 2 * time.Second, Duration: 10 * time.Millisecond,
+		Frequency: 441, Volume: 255})
+	s.add(Note{Start: 2*time.Second + 5*time.Millisecond, Duration: time.Second})
+
+	buf := s.render(nil, SampleRate/50)
+	cut := SampleRate / 200
+	for i, v := range buf {
+		if (i < cut) != (v != 0) {
+			t.Fatalf("sample %d = %d, the note must only play for %d samples",
+				i, v, cut)
+		}
+	}
+	if s.pos != len(buf) {
+		t.Errorf("%d samples rendered, position %d", len(buf), s.pos)
+	}
+
+	// the rest is still scheduled, and ends after the time it lasts
+	if len(s.notes) != 1 {
+		t.Fatalf("%d notes scheduled, want the rest", len(s.notes))
+	}
+	s.render(buf[:0], SampleRate)
+	if len(s.render(buf[:0], 1)) != 1 || len(s.notes) != 0 {
+		t.Errorf("%d notes scheduled after they ended", len(s.notes))
+	}
+}
+
+func TestSchedulerTiming(t *testing.T) {
+	var s scheduler
+	s.add(Note{Start: 0, Duration: time.Millisecond})
+	s.render(nil, SampleRate/10)
+	now := durationOf(s.pos)
+
+	// a note that arrives late plays as soon as possible, and the notes after
+	// it keep the time between them
+	s.add(Note{Start: 10 * time.Millisecond, Duration: time.Second})
+	s.add(Note{Start: 20 * time.Millisecond, Duration: time.Second})
+	if s.notes[0].Start != now || s.notes[1].Start != now+10*time.Millisecond {
+		t.Errorf("late notes scheduled at %v and %v, want %v and 10ms after",
+			s.notes[0].Start, s.notes[1].Start, now)
+	}
+
+	// notes too far ahead are brought closer, and while the program runs
+	// faster than real time they supersede each other
+	s.add(Note{Start: time.Hour, Duration: time.Second})
+	s.add(Note{Start: time.Hour + time.Millisecond, Duration: time.Second,
+		Frequency: 100})
+	if len(s.notes) != 3 || s.notes[2].Start != now+maxAhead ||
+		s.notes[2].Frequency != 100 {
+		t.Errorf("notes ahead scheduled as %+v, want one at %v", s.notes,
+			now+maxAhead)
+	}
+
+	// once there is time, they keep the time between them again
+	s.render(nil, SampleRate)
+	s.add(Note{Start: time.Hour + 2*time.Millisecond, Duration: time.Second})
+	last := s.notes[len(s.notes)-1]
+	if last.Start != now+maxAhead+time.Millisecond || last.Frequency == 100 {
+		t.Errorf("note scheduled at %v, want %v after the last one", last.Start,
+			now+maxAhead+time.Millisecond)
+	}
+}
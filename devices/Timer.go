@@ -0,0 +1,153 @@
+// package devices implements peripherals for the ICMC processor, to be mapped
+// to a range of data addresses with ICMCProcessor.MapDevice.
+package devices
+
+import (
+	"fmt"
+
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+)
+
+// the registers of a Timer, as offsets from the address it is mapped to.
+const (
+	TimerControl = iota // the TimerEnable and TimerCycles bits
+	TimerPeriod         // instructions or cycles between interrupts
+	TimerCount          // instructions or cycles since the last interrupt
+	TimerFired          // interrupts raised since it was last written
+
+	TimerSize // the number of registers, and of addresses to map
+)
+
+// the bits of the TimerControl register.
+const (
+	TimerEnable = 1 << 0 // the timer is counting
+	TimerCycles = 1 << 1 // count clock cycles instead of instructions
+)
+
+// Timer is a programmable timer that raises an interrupt every TimerPeriod
+// instructions or clock cycles, so that programs do not have to busy-wait.
+// A period of zero stops the timer, as does clearing TimerEnable.
+type Timer struct {
+	control uint16
+	period  uint16
+	count   uint16
+	fired   uint16
+}
+
+// NewTimer creates a stopped timer.
+func NewTimer() *Timer {
+	return &Timer{}
+}
+
+// MapTimer creates a timer and maps it to the TimerSize addresses from addr,
+// as set by a command line flag.
+func MapTimer(pr *processor.ICMCProcessor, addr int) (*Timer, error) {
+	t := NewTimer()
+	if err := mapAt(pr, addr, TimerSize, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// mapAt maps a device with a number of registers to the addresses from addr,
+// checking that addr, an int from a command line flag, fits.
+func mapAt(pr *processor.ICMCProcessor, addr, size int, d processor.Device) error {
+	if addr < 0 || addr+size > 1<<15 {
+		return fmt.Errorf("invalid device address %d", addr)
+	}
+	return pr.MapDevice(uint16(addr), uint16(addr+size-1), d)
+}
+
+// checkTimerControl returns an error if a TimerControl value has bits other
+// than TimerEnable and TimerCycles.
+func checkTimerControl(v uint16) error {
+	if v&^(TimerEnable|TimerCycles) != 0 {
+		return fmt.Errorf("invalid timer control %016b", v)
+	}
+	return nil
+}
+
+func (t *Timer) Read(offset uint16) (uint16, error) {
+	switch offset {
+	case TimerControl:
+		return t.control, nil
+	case TimerPeriod:
+		return t.period, nil
+	case TimerCount:
+		return t.count, nil
+	case TimerFired:
+		return t.fired, nil
+	}
+	return 0, fmt.Errorf("timer has no register %d", offset)
+}
+
+func (t *Timer) Write(offset, v uint16) error {
+	switch offset {
+	case TimerControl:
+		if err := checkTimerControl(v); err != nil {
+			return err
+		}
+		t.control = v
+	case TimerPeriod:
+		t.period = v
+	case TimerCount:
+		t.count = v
+	case TimerFired:
+		t.fired = v
+	default:
+		return fmt.Errorf("timer has no register %d", offset)
+	}
+	return nil
+}
+
+func (t *Timer) Reset() {
+	*t = Timer{}
+}
+
+// State returns the timer registers, in order.
+func (t *Timer) State() []uint16 {
+	return []uint16{t.control, t.period, t.count, t.fired}
+}
+
+// ValidateState returns an error if the registers in a state are invalid.
+func (t *Timer) ValidateState(state []uint16) error {
+	if len(state) != TimerSize {
+		return fmt.Errorf("timer state with %d registers, want %d", len(state),
+			TimerSize)
+	}
+	return checkTimerControl(state[TimerControl])
+}
+
+// SetState restores the registers returned by State.
+func (t *Timer) SetState(state []uint16) error {
+	if err := t.ValidateState(state); err != nil {
+		return err
+	}
+	t.control, t.period, t.count, t.fired = state[TimerControl],
+		state[TimerPeriod], state[TimerCount], state[TimerFired]
+	return nil
+}
+
+// Tick counts an instruction that took a number of cycles, returning true
+// when the period is reached. If the period is reached more than once (for
+// periods shorter than an instruction), a single interrupt is raised.
+func (t *Timer) Tick(cycles uint64) bool {
+	if t.control&TimerEnable == 0 || t.period == 0 {
+		return false
+	}
+
+	n := uint64(1)
+	if t.control&TimerCycles != 0 {
+		n = cycles
+	}
+
+	count := uint64(t.count) + n
+	if count < uint64(t.period) {
+		t.count = uint16(count)
+		return false
+	}
+
+	t.count = uint16(count % uint64(t.period))
+	t.fired++
+	return true
+}
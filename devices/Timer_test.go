@@ -0,0 +1,113 @@
+package devices
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasgpulcinelli/goICMCsim/assembler"
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+)
+
+// timerProgram waits for 3 interrupts of a timer mapped at 1000, with a
+// period of 5 instructions, then reads how many were raised. One more may be
+// taken before di.
+const timerProgram = `
+	loadn r0, #handler
+	setiv r0
+	loadn r0, #5
+	store 1001, r0
+	loadn r0, #1
+	store 1000, r0
+	ei
+	loadn r1, #3
+loop:
+	cmp r2, r1
+	jne loop
+	di
+	load r3, 1003
+	halt
+
+handler:
+	inc r2
+	reti
+`
+
+func TestTimerInterrupts(t *testing.T) {
+	words, err := assembler.Assemble(strings.NewReader(timerProgram))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pr := processor.NewEmptyProcessor(nil, nil)
+	copy(pr.Code[:], words)
+	timer := NewTimer()
+	if err := pr.MapDevice(1000, 1000+TimerSize-1, timer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pr.Reset()
+
+	stop := time.AfterFunc(5*time.Second, func() { pr.Stop() })
+	defer stop.Stop()
+
+	var period time.Duration
+	if err := pr.RunUntilHalt(&period); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	handled, raised := pr.GPRRegs[2], pr.GPRRegs[3]
+	if handled < 3 || handled > 4 || raised != handled {
+		t.Errorf("%d interrupts handled and %d raised, want 3 or 4", handled,
+			raised)
+	}
+	if pr.SP != (1<<15)-1 {
+		t.Errorf("SP = %d after the interrupts", pr.SP)
+	}
+}
+
+func TestTimerTick(t *testing.T) {
+	timer := NewTimer()
+	if timer.Tick(4) {
+		t.Errorf("stopped timer raised an interrupt")
+	}
+
+	timer.Write(TimerPeriod, 10)
+	timer.Write(TimerControl, TimerEnable|TimerCycles)
+	fired := 0
+	for i := 0; i < 25; i++ {
+		if timer.Tick(4) {
+			fired++
+		}
+	}
+	if count, _ := timer.Read(TimerCount); fired != 10 || count != 0 {
+		t.Errorf("%d interrupts and count %d in 100 cycles, want 10 and 0",
+			fired, count)
+	}
+
+	if err := timer.Write(TimerControl, 1<<2); err == nil {
+		t.Errorf("invalid control accepted")
+	}
+	if _, err := timer.Read(TimerSize); err == nil {
+		t.Errorf("register outside the timer read")
+	}
+
+	state := timer.State()
+	timer.Reset()
+	if v, _ := timer.Read(TimerFired); v != 0 {
+		t.Errorf("fired = %d after a reset", v)
+	}
+
+	if err := timer.SetState(state); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, _ := timer.Read(TimerFired); v != 10 {
+		t.Errorf("fired = %d after restoring the state, want 10", v)
+	}
+	if err := timer.SetState([]uint16{1 << 2, 0, 0, 0}); err == nil ||
+		!reflect.DeepEqual(timer.State(), state) {
+		t.Errorf("state with an invalid control accepted")
+	}
+	if err := timer.SetState(state[:2]); err == nil {
+		t.Errorf("state with 2 registers accepted")
+	}
+}
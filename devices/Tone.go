@@ -0,0 +1,222 @@
+package devices
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+)
+
+// the registers of a Tone, as offsets from the address it is mapped to.
+const (
+	ToneFrequency = iota // in Hz, zero for a rest
+	ToneDuration         // in milliseconds
+	ToneVolume           // from 0 to 255
+	TonePlay             // written to play a note, read as 1 while playing
+
+	ToneSize // the number of registers, and of addresses to map
+)
+
+const (
+	// ToneClock is the clock used to measure the time of notes, in cycles per
+	// second. Time is counted in cycles instead of the real time so that the
+	// sound of a program is always the same, no matter how fast it runs.
+	ToneClock = 1000000
+
+	maxFrequency  = 20000 // the highest frequency that can be heard
+	defaultVolume = 128   // the volume after a reset
+)
+
+// Note is a square wave played by a Tone, with the time it started since the
+// tone was reset.
+type Note struct {
+	Start     time.Duration
+	Duration  time.Duration
+	Frequency uint16
+	Volume    uint8
+}
+
+// Tone is a tone generator, that plays a note when TonePlay is written with
+// the frequency, duration and volume in the other registers. A single note
+// plays at a time, so a new one cuts the one playing.
+type Tone struct {
+	frequency uint16
+	duration  uint16
+	volume    uint16
+
+	clock  uint64 // cycles per second
+	cycles uint64 // cycles run since the last reset
+	end    uint64 // the cycle the last note ends at
+	notes  []Note // only kept if Record is set
+
+	// Record makes Notes keep every note played, such as to write them to a
+	// WAV file. It is not set by default, as a program may play notes
+	// forever.
+	Record bool
+
+	// OnPlay is called when a note starts, to play it in the host. The
+	// duration is the one requested, a note is cut at the Start of the next
+	// one if it is still playing, as HostPlayer does.
+	OnPlay func(n Note)
+}
+
+// NewTone creates a tone generator measuring time with a clock, in cycles
+// per second, such as ToneClock.
+func NewTone(clock uint64) *Tone {
+	return &Tone{clock: clock, volume: defaultVolume}
+}
+
+// MapTone creates a tone generator with ToneClock and maps it to the ToneSize
+// addresses from addr, as set by a command line flag.
+func MapTone(pr *processor.ICMCProcessor, addr int) (*Tone, error) {
+	t := NewTone(ToneClock)
+	if err := mapAt(pr, addr, ToneSize, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// now returns the time since the last reset, from the cycles run.
+func (t *Tone) now() time.Duration {
+	return time.Duration(t.cycles/t.clock)*time.Second +
+		time.Duration(t.cycles%t.clock*uint64(time.Second)/t.clock)
+}
+
+// playing returns if the last note is still playing.
+func (t *Tone) playing() bool {
+	return t.cycles < t.end
+}
+
+// play starts a note with the current registers.
+func (t *Tone) play() {
+	n := Note{
+		Start:     t.now(),
+		Duration:  time.Duration(t.duration) * time.Millisecond,
+		Frequency: t.frequency,
+		Volume:    uint8(t.volume),
+	}
+
+	if t.Record {
+		// the note playing is cut by the new one
+		if t.playing() && len(t.notes) != 0 {
+			last := &t.notes[len(t.notes)-1]
+			last.Duration = n.Start - last.Start
+		}
+		t.notes = append(t.notes, n)
+	}
+
+	t.end = t.cycles + uint64(t.duration)*t.clock/1000
+	if t.OnPlay != nil {
+		t.OnPlay(n)
+	}
+}
+
+// Notes returns all notes played since the last reset, if Record is set.
+func (t *Tone) Notes() []Note {
+	return t.notes
+}
+
+// checkFrequency returns an error if a frequency can't be heard.
+func checkFrequency(v uint16) error {
+	if v > maxFrequency {
+		return fmt.Errorf("frequency %d Hz above %d Hz", v, maxFrequency)
+	}
+	return nil
+}
+
+// checkVolume returns an error if a volume is above 255.
+func checkVolume(v uint16) error {
+	if v > 255 {
+		return fmt.Errorf("volume %d above 255", v)
+	}
+	return nil
+}
+
+func (t *Tone) Read(offset uint16) (uint16, error) {
+	switch offset {
+	case ToneFrequency:
+		return t.frequency, nil
+	case ToneDuration:
+		return t.duration, nil
+	case ToneVolume:
+		return t.volume, nil
+	case TonePlay:
+		if t.playing() {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("tone generator has no register %d", offset)
+}
+
+func (t *Tone) Write(offset, v uint16) error {
+	switch offset {
+	case ToneFrequency:
+		if err := checkFrequency(v); err != nil {
+			return err
+		}
+		t.frequency = v
+	case ToneDuration:
+		t.duration = v
+	case ToneVolume:
+		if err := checkVolume(v); err != nil {
+			return err
+		}
+		t.volume = v
+	case TonePlay:
+		t.play()
+	default:
+		return fmt.Errorf("tone generator has no register %d", offset)
+	}
+	return nil
+}
+
+func (t *Tone) Reset() {
+	*t = Tone{clock: t.clock, volume: defaultVolume, Record: t.Record,
+		OnPlay: t.OnPlay}
+}
+
+// State returns the registers, the cycles run and the cycle the last note
+// ends at, the cycles as 4 words each from the most significant one. The
+// notes recorded are not part of the state.
+func (t *Tone) State() []uint16 {
+	state := []uint16{t.frequency, t.duration, t.volume}
+	for _, v := range []uint64{t.cycles, t.end} {
+		state = append(state, uint16(v>>48), uint16(v>>32), uint16(v>>16), uint16(v))
+	}
+	return state
+}
+
+// ValidateState returns an error if a state has the wrong size or invalid
+// registers.
+func (t *Tone) ValidateState(state []uint16) error {
+	if len(state) != 11 {
+		return fmt.Errorf("tone generator state with %d words, want 11", len(state))
+	}
+	if err := checkFrequency(state[ToneFrequency]); err != nil {
+		return err
+	}
+	return checkVolume(state[ToneVolume])
+}
+
+// SetState restores a state returned by State.
+func (t *Tone) SetState(state []uint16) error {
+	if err := t.ValidateState(state); err != nil {
+		return err
+	}
+	t.frequency, t.duration, t.volume = state[ToneFrequency],
+		state[ToneDuration], state[ToneVolume]
+
+	words := func(w []uint16) uint64 {
+		return uint64(w[0])<<48 | uint64(w[1])<<32 | uint64(w[2])<<16 | uint64(w[3])
+	}
+	t.cycles, t.end = words(state[3:7]), words(state[7:11])
+	return nil
+}
+
+// Tick counts the cycles run, to know when notes start and end. It never
+// raises an interrupt.
+func (t *Tone) Tick(cycles uint64) bool {
+	t.cycles += cycles
+	return false
+}
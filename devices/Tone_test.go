@@ -0,0 +1,191 @@
+package devices
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasgpulcinelli/goICMCsim/assembler"
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+)
+
+// toneProgram plays two notes with a tone generator mapped at 2000, waiting
+// for the first one to end.
+const toneProgram = `
+	loadn r0, #440
+	store 2000, r0
+	loadn r0, #10
+	store 2001, r0
+	store 2003, r0
+	loadn r1, #0
+wait:
+	load r0, 2003
+	cmp r0, r1
+	jne wait
+	loadn r0, #0
+	store 2000, r0
+	store 2003, r0
+	halt
+`
+
+// runTone runs toneProgram, returning the notes played.
+func runTone(t *testing.T) []Note {
+	t.Helper()
+
+	words, err := assembler.Assemble(strings.NewReader(toneProgram))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pr := processor.NewEmptyProcessor(nil, nil)
+	copy(pr.Code[:], words)
+	tone, err := MapTone(pr, 2000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tone.Record = true
+	pr.Reset()
+
+	var played []Note
+	tone.OnPlay = func(n Note) { played = append(played, n) }
+
+	var period time.Duration
+	if err := pr.RunUntilHalt(&period); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(played) != len(tone.Notes()) {
+		t.Errorf("%d notes played in the host, %d recorded", len(played),
+			len(tone.Notes()))
+	}
+	return tone.Notes()
+}
+
+func TestTone(t *testing.T) {
+	notes := runTone(t)
+	if len(notes) != 2 {
+		t.Fatalf("%d notes played, want 2", len(notes))
+	}
+
+	// 4 instructions of 3 and 4 cycles before the first store to TonePlay
+	first := Note{Start: 14 * time.Microsecond, Duration: 10 * time.Millisecond,
+		Frequency: 440, Volume: defaultVolume}
+	if notes[0] != first {
+		t.Errorf("first note %+v, want %+v", notes[0], first)
+	}
+
+	// the loop only ends after the first note, always at the same cycle
+	end := first.Start + first.Duration
+	if notes[1].Start != 10038*time.Microsecond {
+		t.Errorf("second note at %v, want 10.038ms, right after %v",
+			notes[1].Start, end)
+	}
+	if notes[1].Frequency != 0 {
+		t.Errorf("second note at %d Hz, want a rest", notes[1].Frequency)
+	}
+}
+
+func TestToneCut(t *testing.T) {
+	tone := NewTone(ToneClock)
+	tone.Record = true
+	tone.Write(ToneFrequency, 100)
+	tone.Write(ToneDuration, 1000)
+	tone.Write(TonePlay, 1)
+	tone.Tick(ToneClock / 2)
+	if v, _ := tone.Read(TonePlay); v != 1 {
+		t.Errorf("note not playing after half of it")
+	}
+
+	tone.Write(TonePlay, 1)
+	if d := tone.Notes()[0].Duration; d != time.Second/2 {
+		t.Errorf("cut note lasted %v, want %v", d, time.Second/2)
+	}
+
+	tone.Tick(ToneClock)
+	if v, _ := tone.Read(TonePlay); v != 0 {
+		t.Errorf("note playing after it ended")
+	}
+
+	if err := tone.Write(ToneVolume, 256); err == nil {
+		t.Errorf("invalid volume accepted")
+	}
+	if err := tone.Write(ToneFrequency, 30000); err == nil {
+		t.Errorf("inaudible frequency accepted")
+	}
+
+	tone.Reset()
+	if len(tone.Notes()) != 0 {
+		t.Errorf("notes kept after a reset")
+	}
+}
+
+func TestToneState(t *testing.T) {
+	tone := NewTone(ToneClock)
+	tone.Write(ToneFrequency, 440)
+	tone.Write(ToneDuration, 1000)
+	tone.Write(TonePlay, 1)
+	tone.Tick(ToneClock / 2)
+	if len(tone.Notes()) != 0 {
+		t.Errorf("notes recorded without Record")
+	}
+
+	// the note is still playing in the restored tone generator, until the
+	// time left in it passes
+	state := tone.State()
+	restored := NewTone(ToneClock)
+	if err := restored.SetState(state); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f, _ := restored.Read(ToneFrequency); f != 440 {
+		t.Errorf("frequency %d after restoring, want 440", f)
+	}
+	if v, _ := restored.Read(TonePlay); v != 1 {
+		t.Errorf("note not playing after restoring")
+	}
+	restored.Tick(ToneClock / 2)
+	if v, _ := restored.Read(TonePlay); v != 0 {
+		t.Errorf("note playing after it ended")
+	}
+
+	state[ToneVolume] = 256
+	if err := restored.SetState(state); err == nil {
+		t.Errorf("state with an invalid volume accepted")
+	}
+	if err := restored.SetState(state[:3]); err == nil {
+		t.Errorf("state without the cycles accepted")
+	}
+}
+
+func TestWriteWAV(t *testing.T) {
+	var a, b bytes.Buffer
+	if err := WriteWAV(&a, runTone(t)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	WriteWAV(&b, runTone(t))
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Errorf("two runs of the same program sound different")
+	}
+
+	var h wavHeader
+	binary.Read(&a, binary.LittleEndian, &h)
+	if string(h.RIFF[:]) != "RIFF" || string(h.WAVE[:]) != "WAVE" ||
+		h.SampleRate != SampleRate || h.DataSize != uint32(a.Len()) {
+		t.Errorf("invalid header %+v with %d bytes of data", h, a.Len())
+	}
+
+	// a 441 Hz wave has 50 samples high and 50 low
+	samples := Render([]Note{{0, time.Second / 100, 441, 255}})
+	for i, s := range samples {
+		want := int16(1<<15 - 1)
+		if i%100 >= 50 {
+			want = -want
+		}
+		if s != want {
+			t.Fatalf("sample %d = %d, want %d", i, s, want)
+		}
+	}
+	if len(samples) != SampleRate/100 {
+		t.Errorf("%d samples in 10ms, want %d", len(samples), SampleRate/100)
+	}
+}
@@ -0,0 +1,98 @@
+package devices
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// SampleRate is the rate of the sound rendered from notes, in samples per
+// second.
+const SampleRate = 44100
+
+// samplesIn returns the number of samples in a duration.
+func samplesIn(d time.Duration) int {
+	return int(d/time.Second)*SampleRate +
+		int(int64(d%time.Second)*SampleRate/int64(time.Second))
+}
+
+// sample returns the sample i of a note, as a 16 bit signed integer. Only
+// integers are used, so that the samples are the same in any machine.
+func sample(n Note, i int64) int16 {
+	if n.Frequency == 0 {
+		return 0
+	}
+
+	// the half period the sample is in tells if the wave is high or low
+	amp := int16(int(n.Volume) * (1<<15 - 1) / 255)
+	if i*int64(n.Frequency)*2/SampleRate%2 == 0 {
+		return amp
+	}
+	return -amp
+}
+
+// renderNote appends the samples of a note to buf.
+func renderNote(buf []int16, n Note) []int16 {
+	for i := int64(0); i < int64(samplesIn(n.Duration)); i++ {
+		buf = append(buf, sample(n, i))
+	}
+	return buf
+}
+
+// Render returns the samples of a sequence of notes in the time they were
+// played, with silence between them.
+func Render(notes []Note) []int16 {
+	var buf []int16
+	for _, n := range notes {
+		if start := samplesIn(n.Start); start > len(buf) {
+			buf = append(buf, make([]int16, start-len(buf))...)
+		}
+		buf = renderNote(buf, n)
+	}
+	return buf
+}
+
+// wavHeader is the header of a mono 16 bit PCM WAV file.
+type wavHeader struct {
+	RIFF          [4]byte
+	Size          uint32
+	WAVE          [4]byte
+	Fmt           [4]byte
+	FmtSize       uint32
+	Format        uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+	Data          [4]byte
+	DataSize      uint32
+}
+
+// WriteWAV writes the notes played by a tone generator to a WAV file, mono
+// with 16 bit samples at SampleRate.
+func WriteWAV(w io.Writer, notes []Note) error {
+	samples := Render(notes)
+	dataSize := uint32(len(samples) * 2)
+
+	h := wavHeader{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		Size:          36 + dataSize,
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		Format:        1, // PCM
+		Channels:      1,
+		SampleRate:    SampleRate,
+		ByteRate:      SampleRate * 2,
+		BlockAlign:    2,
+		BitsPerSample: 16,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      dataSize,
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, h); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, samples)
+}
@@ -16,6 +16,9 @@ import (
 	"github.com/lucasgpulcinelli/goICMCsim/processor"
 )
 
+// journalSize is the amount of instructions that can be stepped back.
+const journalSize = 1 << 16
+
 var (
 	icmcSimulator  *processor.ICMCProcessor // main simulator instance itself
 	simulatorMutex sync.Mutex               // mutex to sync simulator actions
@@ -68,8 +71,12 @@ func setupInput() {
 }
 
 // StartSimulatorWindow creates and starts the execution of the ICMC simulator.
-// it takes as input the initial MIFs for code and character mapping.
-func StartSimulatorWindow(codem, charm io.ReadCloser) {
+// it takes as input the initial MIFs for code and character mapping, and a
+// function to configure the processor (such as it's profile and devices)
+// before anything is loaded.
+func StartSimulatorWindow(codem, charm io.ReadCloser,
+	setup func(pr *processor.ICMCProcessor)) {
+
 	instructionPeriod = new(time.Duration)
 
 	// initializes the first key pressed with 255
@@ -77,6 +84,8 @@ func StartSimulatorWindow(codem, charm io.ReadCloser) {
 
 	// create a new processor with out input and output functions
 	icmcSimulator = processor.NewEmptyProcessor(FyneInChar, draw.FyneOutChar)
+	icmcSimulator.SetJournalSize(journalSize)
+	setup(icmcSimulator)
 
 	// create the new fyne app, with a title and content defined in other
 	// functions.
@@ -21,6 +21,7 @@ var (
 	charactersDrawn [sh][sw]uint16  // the characters previously drawn. Used when changing charmaps during runtime
 	screen          *image.Paletted // the actual image with the simulator output characters
 	charMIF         [128][8]byte    // the binary representation of characters: an 8x8 bitfield for each ascii character
+	charMIFSet      bool            // if charMIF was ever defined by SetCharData
 	viewport        *canvas.Image   // the fyne component to display screen
 	shouldDraw      atomic.Int32    // an atomic variable to ease the draw thread but keep it from missing updates
 	icmcColors      = []color.Color{
@@ -109,9 +110,36 @@ func SetCharData(data []byte) error {
 			charMIF[i][j] = data[i*len(charMIF[i])+j]
 		}
 	}
+	charMIFSet = true
 	return nil
 }
 
+// GetCharData returns the character mapping in the same format SetCharData
+// takes, or nil if no mapping was ever set.
+func GetCharData() []byte {
+	if !charMIFSet {
+		return nil
+	}
+
+	data := make([]byte, 0, 128*8)
+	for i := range charMIF {
+		data = append(data, charMIF[i][:]...)
+	}
+	return data
+}
+
+// GetScreen returns every character drawn in the screen, with it's color in
+// the higher byte.
+func GetScreen() [sh][sw]uint16 {
+	return charactersDrawn
+}
+
+// SetScreen replaces every character in the screen and redraws it.
+func SetScreen(s [sh][sw]uint16) {
+	charactersDrawn = s
+	shouldDraw.Store(1)
+}
+
 // UpdateChar sets the character at position x, y (where x <= 40, y <= 30)
 // using the char MIF mapping to c, where the color is at it's higher byte.
 func updateChar(x, y int, c uint16) {
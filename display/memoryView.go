@@ -0,0 +1,268 @@
+package display
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// stackRows is the amount of words shown in the stack view, starting at SP.
+const stackRows = 32
+
+var (
+	memWindow   fyne.Window     // memory viewer window, nil if it is closed
+	memTable    *widget.Table   // the table with all Data words
+	stackList   *widget.List    // the stack region, anchored at SP
+	memFormat   = "hex"         // how words are shown: hex, decimal or char
+	memColumns  = 8             // words shown per table row
+	memFound    = -1            // last address found by a search
+	prevData    [1 << 15]uint16 // Data before the last step, to highlight changes
+	memFormats  = []string{"hex", "decimal", "char"}
+	changedFill = color.NRGBA{0xff, 0xa0, 0x00, 0x60} // background of changed words
+)
+
+// snapshotMemory saves the current Data, so that the words changed by the
+// next step or run can be highlighted in the memory viewer.
+func snapshotMemory() {
+	simulatorMutex.Lock()
+	prevData = icmcSimulator.Data
+	simulatorMutex.Unlock()
+}
+
+// formatWord returns the representation of a word in the current format.
+func formatWord(v uint16) string {
+	switch memFormat {
+	case "decimal":
+		return strconv.FormatUint(uint64(v), 10)
+	case "char":
+		c := byte(v)
+		if c < ' ' || c > '~' {
+			return "."
+		}
+		return string(c)
+	}
+	return fmt.Sprintf("%04x", v)
+}
+
+// parseWord reads a word in the current format. In the char format, only the
+// lower byte of old is replaced, keeping the color.
+func parseWord(s string, old uint16) (uint16, error) {
+	switch memFormat {
+	case "decimal":
+		v, err := strconv.ParseUint(s, 10, 16)
+		return uint16(v), err
+	case "char":
+		if len(s) != 1 {
+			return 0, errors.New("expected a single character")
+		}
+		return old&0xff00 | uint16(s[0]), nil
+	}
+
+	v, err := strconv.ParseUint(s, 16, 16)
+	return uint16(v), err
+}
+
+// showMemoryView opens the memory viewer window, or focuses it if it is
+// already open.
+func showMemoryView() {
+	if memWindow != nil {
+		memWindow.RequestFocus()
+		return
+	}
+
+	memWindow = fyne.CurrentApp().NewWindow("ICMC Simulator memory")
+	memWindow.SetOnClosed(func() { memWindow = nil })
+
+	memTable = makeMemoryTable()
+	stackList = makeStackList()
+
+	view := container.NewHSplit(memTable, stackList)
+	view.SetOffset(0.75)
+
+	memWindow.SetContent(container.NewBorder(
+		makeMemoryToolbar(), nil, nil, nil, view,
+	))
+	memWindow.Resize(fyne.NewSize(900, 600))
+	memWindow.Show()
+}
+
+// refreshMemoryView updates the memory viewer with the current Data and SP.
+func refreshMemoryView() {
+	if memWindow == nil {
+		return
+	}
+	memTable.Refresh()
+	stackList.Refresh()
+}
+
+// scrollMemoryTo shows and selects the word at addr in the memory table.
+func scrollMemoryTo(addr int) {
+	id := widget.TableCellID{Row: addr / memColumns, Col: addr % memColumns}
+	memTable.ScrollTo(id)
+	memTable.Select(id)
+}
+
+// makeMemoryToolbar creates the controls for format, words per row, goto
+// address and search.
+func makeMemoryToolbar() fyne.CanvasObject {
+	format := widget.NewSelect(memFormats, func(s string) {
+		memFormat = s
+		refreshMemoryView()
+	})
+	format.SetSelected(memFormat)
+
+	columns := widget.NewSelect([]string{"8", "16"}, func(s string) {
+		memColumns, _ = strconv.Atoi(s)
+		memTable.Refresh()
+	})
+	columns.SetSelected(strconv.Itoa(memColumns))
+
+	gotoEntry := widget.NewEntry()
+	gotoEntry.SetPlaceHolder("address")
+	gotoEntry.OnSubmitted = func(s string) {
+		// accepts decimal, or hexadecimal with a 0x prefix
+		addr, err := strconv.ParseUint(s, 0, 15)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("invalid address: %v", err), memWindow)
+			return
+		}
+		scrollMemoryTo(int(addr))
+	}
+
+	searchEntry := widget.NewEntry()
+	searchEntry.SetPlaceHolder("value to find")
+	searchEntry.OnSubmitted = func(s string) {
+		v, err := parseWord(s, 0)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("invalid value: %v", err), memWindow)
+			return
+		}
+
+		// search after the last word found, wrapping around the memory
+		for i := 1; i <= len(icmcSimulator.Data); i++ {
+			addr := (memFound + i) % len(icmcSimulator.Data)
+			w := icmcSimulator.Data[addr]
+			if w == v || (memFormat == "char" && byte(w) == byte(v)) {
+				memFound = addr
+				scrollMemoryTo(addr)
+				return
+			}
+		}
+		dialog.ShowInformation("search", "value not found in memory", memWindow)
+	}
+
+	return container.NewGridWithColumns(4,
+		format, columns, gotoEntry, searchEntry,
+	)
+}
+
+// makeMemoryTable creates the table with all Data words, editable in the
+// current format while the simulator is stopped. Words changed by the last
+// step or run are highlighted.
+func makeMemoryTable() *widget.Table {
+	table := widget.NewTableWithHeaders(
+		func() (int, int) { return len(icmcSimulator.Data) / memColumns, memColumns },
+		func() fyne.CanvasObject {
+			return container.NewStack(canvas.NewRectangle(color.Transparent),
+				widget.NewEntry())
+		},
+		func(id widget.TableCellID, obj fyne.CanvasObject) {
+			cell := obj.(*fyne.Container)
+			bg := cell.Objects[0].(*canvas.Rectangle)
+			entry := cell.Objects[1].(*widget.Entry)
+
+			addr := id.Row*memColumns + id.Col
+			if addr >= len(icmcSimulator.Data) {
+				entry.OnSubmitted = nil
+				entry.SetText("")
+				return
+			}
+
+			v := icmcSimulator.Data[addr]
+			entry.OnSubmitted = nil
+			entry.SetText(formatWord(v))
+			entry.OnSubmitted = func(s string) { editMemory(addr, s) }
+
+			if v != prevData[addr] {
+				bg.FillColor = changedFill
+			} else {
+				bg.FillColor = color.Transparent
+			}
+			bg.Refresh()
+		},
+	)
+
+	table.CreateHeader = func() fyne.CanvasObject { return widget.NewLabel("") }
+	table.UpdateHeader = func(id widget.TableCellID, obj fyne.CanvasObject) {
+		if id.Col == -1 {
+			obj.(*widget.Label).SetText(fmt.Sprintf("%.5d", id.Row*memColumns))
+		} else {
+			obj.(*widget.Label).SetText(fmt.Sprintf("+%d", id.Col))
+		}
+	}
+
+	for i := 0; i < 16; i++ {
+		table.SetColumnWidth(i, 4*theme.TextSize()+2*theme.InnerPadding())
+	}
+
+	return table
+}
+
+// editMemory writes a value typed in the memory table to Data, as an edit
+// that can be stepped back.
+func editMemory(addr int, s string) {
+	if icmcSimulator.IsRunning {
+		dialog.ShowError(errors.New("stop the simulation to edit memory"), memWindow)
+		return
+	}
+
+	simulatorMutex.Lock()
+	v, err := parseWord(s, icmcSimulator.Data[addr])
+	if err != nil {
+		err = fmt.Errorf("invalid value: %v", err)
+	} else {
+		err = icmcSimulator.WriteMemory(uint16(addr), v)
+	}
+	simulatorMutex.Unlock()
+
+	if err != nil {
+		dialog.ShowError(err, memWindow)
+	}
+	updateAllDisplay()
+}
+
+// makeStackList creates the list showing the stack region: the free word SP
+// points to followed by the words pushed before it, starting with the top.
+func makeStackList() *widget.List {
+	return widget.NewList(
+		func() int { return stackRows },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i int, obj fyne.CanvasObject) {
+			addr := int(icmcSimulator.SP) + i
+			label := obj.(*widget.Label)
+
+			if addr >= len(icmcSimulator.Data) {
+				label.SetText("")
+				return
+			}
+
+			marker := "      "
+			switch i {
+			case 0:
+				marker = "SP  ->"
+			case 1:
+				marker = "top ->"
+			}
+			label.SetText(fmt.Sprintf("%s %.5d | %s", marker, addr,
+				formatWord(icmcSimulator.Data[addr])))
+		},
+	)
+}
@@ -4,12 +4,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"strings"
 	"time"
 
+	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
 
 	"github.com/lucasgpulcinelli/goICMCsim/MIF"
+	"github.com/lucasgpulcinelli/goICMCsim/assembler"
 	"github.com/lucasgpulcinelli/goICMCsim/display/draw"
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+	"github.com/lucasgpulcinelli/goICMCsim/snapshot"
+	"github.com/lucasgpulcinelli/goICMCsim/trace"
 )
 
 // fyneReadMIFCode reads the instructions from a code MIF file and loads them
@@ -25,38 +33,63 @@ func fyneReadMIFCode(f io.ReadCloser) {
 	// create a new MIF parser and read everything
 	p := MIF.NewParser(f)
 	if err = p.Parse(); err != nil {
-		dialog.ShowError(err, window)
+		showMIFErrors(err, "code MIF")
 		return
 	}
+	if warnings := p.GetErrors(); len(warnings) != 0 {
+		showMIFErrors(warnings, "code MIF")
+	}
 
-	data := p.GetData()
-	if len(data) != 1<<16 {
+	width, depth := p.GetDimensions()
+	if width != 16 || depth != 1<<15 {
 		dialog.ShowError(
-			fmt.Errorf("the MIF is not the right size for code: %d", len(data)),
+			fmt.Errorf("the MIF is not the right size for code: width %d, depth %d",
+				width, depth),
 			window,
 		)
 		return
 	}
 
-	icmcSimulator.IsRunning = false
-	simulatorMutex.Lock()
+	// the words are 16 bits wide, so they fit the ICMC simulator code as is
+	words := make([]uint16, depth)
+	for i, w := range p.GetWords() {
+		words[i] = uint16(w)
+	}
+
+	loadCode(words)
+	f.Close()
+}
+
+// fyneReadAsmCode assembles an ICMC assembly source file and loads the
+// resulting program into the simulator, as if a code MIF was opened.
+func fyneReadAsmCode(f io.ReadCloser) {
+	if f == nil {
+		dialog.ShowError(errors.New("reader is nil"), window)
+		return
+	}
+	defer f.Close()
 
-	// read the data in 16 bit words into the ICMC simulator code
-	for i := 0; i < len(data); i += 2 {
-		icmcSimulator.Code[i/2] = (uint16(data[i]) << 8) + uint16(data[i+1])
+	words, err := assembler.Assemble(f)
+	if err != nil {
+		dialog.ShowError(err, window)
+		return
 	}
 
+	loadCode(words)
+}
+
+// loadCode replaces the simulator code with the words provided and restarts
+// it.
+func loadCode(words []uint16) {
+	stopSim()
+	simulatorMutex.Lock()
+	copy(icmcSimulator.Code[:], words)
 	simulatorMutex.Unlock()
 
 	// reset the viewport and restart the whole simulator, because old values for
 	// registers don't make sense anymore
 	draw.Reset()
 	restartCode()
-	f.Close()
-
-	if err != nil {
-		dialog.ShowError(err, window)
-	}
 }
 
 // fyneReadMIFChar reads the character mapping definition from a MIF file and
@@ -75,21 +108,26 @@ func fyneReadMIFChar(f io.ReadCloser) {
 	// create a new MIF parser and read everything
 	p := MIF.NewParser(f)
 	if err = p.Parse(); err != nil {
-		dialog.ShowError(err, window)
+		showMIFErrors(err, "char MIF")
 		return
 	}
+	if warnings := p.GetErrors(); len(warnings) != 0 {
+		showMIFErrors(warnings, "char MIF")
+	}
 
-	data := p.GetData()
-	if len(data) != 1<<10 {
+	// the size is checked before the data is allocated, as DEPTH can be huge
+	if width, depth := p.GetDimensions(); (width+7)/8*depth != 1<<10 {
 		dialog.ShowError(
-			fmt.Errorf("the MIF is not the correct size for char: %d", len(data)),
+			fmt.Errorf("the MIF is not the correct size for char: %d bytes",
+				(width+7)/8*depth),
 			window,
 		)
 		return
 	}
+	data := p.GetData()
 
 	// set the charmap to draw with
-	draw.SetCharData(p.GetData())
+	draw.SetCharData(data)
 	draw.RedrawScreen()
 	f.Close()
 
@@ -101,12 +139,13 @@ func fyneReadMIFChar(f io.ReadCloser) {
 // restartCode resets the whole simulator to their default state,
 // the same when first initialized.
 func restartCode() {
-	icmcSimulator.IsRunning = false
+	stopSim()
 
 	simulatorMutex.Lock()
 	icmcSimulator.Reset()
 	simulatorMutex.Unlock()
 
+	snapshotMemory()
 	draw.Reset()
 	updateAllDisplay()
 }
@@ -126,13 +165,46 @@ func getClockText(instructionsPerSec float32) string {
 	return fmt.Sprintf("clock:%8.2f %sHz", instructionsPerSec, scaleStr)
 }
 
+// getDriftText returns how far the achieved clock is from the requested one,
+// or nothing if no clock was requested or it is close enough.
+func getDriftText(stats processor.ClockStats) string {
+	if stats.Requested == 0 {
+		return ""
+	}
+
+	drift := (stats.Achieved - stats.Requested) / stats.Requested * 100
+	if math.Abs(drift) < 1 {
+		return ""
+	}
+	return fmt.Sprintf(" (%+.0f%%)", drift)
+}
+
+// getCountersText returns the instructions and clock cycles run by the
+// simulator, so that the performance of programs can be measured.
+func getCountersText() string {
+	return fmt.Sprintf("instructions: %d cycles: %d", icmcSimulator.InstCount,
+		icmcSimulator.CycleCount)
+}
+
+// getInterruptText returns if interrupts are enabled and pending, with the
+// interrupt vector.
+func getInterruptText() string {
+	state := "off"
+	if icmcSimulator.InterruptsEnabled() {
+		state = "on"
+	}
+	if icmcSimulator.InterruptPending() {
+		state += ", pending"
+	}
+	return fmt.Sprintf("INT: %s (vector %d)", state, icmcSimulator.IntVector)
+}
+
 // updateClockLabel ticks a 100ms timer to update the clock frequency in the
-// respective label. When the done channel receives a value, the function
-// exits.
+// respective label, with the drift from the clock requested by the slider, and
+// the counters of instructions and cycles run.
+// When the done channel receives a value, the function exits.
 // this functions is expected to run in a dedicated goroutine.
 func updateClockLabel(done chan struct{}) {
-	instStart := icmcSimulator.InstCount
-
 	ticker := time.NewTicker(time.Second / 10)
 	defer ticker.Stop()
 
@@ -141,9 +213,13 @@ func updateClockLabel(done chan struct{}) {
 		case <-done:
 			return
 		case <-ticker.C:
-			instPerSec := icmcSimulator.InstCount - instStart
-			periodLabel.SetText(getClockText(float32(instPerSec * 10)))
-			instStart = icmcSimulator.InstCount
+			stats := icmcSimulator.ClockStats()
+			periodLabel.SetText(getClockText(float32(stats.Achieved)) +
+				getDriftText(stats))
+			countersLabel.SetText(getCountersText())
+
+			// the flags are cheap to show, so they are updated while running
+			updateFlags()
 		}
 	}
 }
@@ -167,6 +243,11 @@ func runUntilHalt() {
 		for i := 0; i < 10; i++ {
 			registers[i].Disable()
 		}
+		for _, check := range flagChecks {
+			check.Disable()
+		}
+
+		snapshotMemory()
 
 		simulatorMutex.Lock()
 		err := icmcSimulator.RunUntilHalt(instructionPeriod)
@@ -175,11 +256,15 @@ func runUntilHalt() {
 		for i := 0; i < 10; i++ {
 			registers[i].Enable()
 		}
+		for _, check := range flagChecks {
+			check.Enable()
+		}
 
 		updateAllDisplay()
 		if err != nil {
 			dialog.ShowError(err, window)
 		}
+		showWatchHit()
 	}()
 }
 
@@ -190,6 +275,8 @@ func runOneInst() {
 		return
 	}
 
+	snapshotMemory()
+
 	simulatorMutex.Lock()
 	err := icmcSimulator.RunInstruction()
 	simulatorMutex.Unlock()
@@ -198,11 +285,63 @@ func runOneInst() {
 	if err != nil && err.Error() != "stop" {
 		dialog.ShowError(err, window)
 	}
+	showWatchHit()
+}
+
+// showWatchHit tells the user which access triggered a watchpoint, if the
+// last instruction executed triggered one.
+func showWatchHit() {
+	hit, ok := icmcSimulator.LastWatchHit()
+	if !ok {
+		return
+	}
+
+	dialog.ShowInformation("watchpoint triggered", fmt.Sprintf("%v\n(%s)",
+		hit, icmcSimulator.GetMnemonic(int(hit.PC), 1)), window)
+}
+
+// stepBack undoes the last instruction run.
+func stepBack() {
+	if icmcSimulator.IsRunning {
+		dialog.ShowError(errors.New("a simulation is already running"), window)
+		return
+	}
+
+	snapshotMemory()
+
+	simulatorMutex.Lock()
+	err := icmcSimulator.StepBack()
+	simulatorMutex.Unlock()
+
+	updateAllDisplay()
+	if err != nil {
+		dialog.ShowError(err, window)
+	}
+}
+
+// runBackUntilBreakpoint undoes instructions until the previous breakpoint,
+// or until there is no more history.
+func runBackUntilBreakpoint() {
+	if icmcSimulator.IsRunning {
+		dialog.ShowError(errors.New("a simulation is already running"), window)
+		return
+	}
+
+	snapshotMemory()
+
+	simulatorMutex.Lock()
+	err := icmcSimulator.RunBackUntilBreakpoint()
+	simulatorMutex.Unlock()
+
+	updateAllDisplay()
+	if err != nil {
+		dialog.ShowError(err, window)
+	}
 }
 
 // stopSim stops the simulation if one was running
 func stopSim() {
-	icmcSimulator.IsRunning = false
+	icmcSimulator.Stop()
 }
 
 // shortcutsHelp creates small help window to show shortcuts and what they do.
@@ -216,3 +355,163 @@ func toggleInstView() {
 	instructionList.Refresh()
 
 }
+
+// toggleBreakpoint sets or removes a breakpoint at an address of the
+// instruction list.
+func toggleBreakpoint(addr int) {
+	icmcSimulator.ToggleBreakpoint(uint16(addr))
+	instructionList.RefreshItem(widget.ListItemID(addr))
+}
+
+// toggleSelectedBreakpoint sets or removes a breakpoint at the instruction
+// currently selected in the instruction list.
+func toggleSelectedBreakpoint() {
+	toggleBreakpoint(selectedInst)
+}
+
+// clearBreakpoints removes all breakpoints from the simulator.
+func clearBreakpoints() {
+	icmcSimulator.ClearBreakpoints()
+	instructionList.Refresh()
+}
+
+// saveState writes a snapshot of the whole simulator (processor, screen and
+// char mapping) to a file.
+func saveState(f io.WriteCloser) {
+	if f == nil {
+		dialog.ShowError(errors.New("writer is nil"), window)
+		return
+	}
+	defer f.Close()
+
+	if icmcSimulator.IsRunning {
+		dialog.ShowError(errors.New("stop the simulation to save it's state"), window)
+		return
+	}
+
+	simulatorMutex.Lock()
+	s, err := snapshot.FromProcessor(icmcSimulator)
+	simulatorMutex.Unlock()
+	if err != nil {
+		dialog.ShowError(err, window)
+		return
+	}
+
+	s.Screen = draw.GetScreen()
+	if charData := draw.GetCharData(); charData != nil {
+		s.HasCharMap = true
+		copy(s.CharMap[:], charData)
+	}
+
+	if err = snapshot.Write(f, s); err != nil {
+		dialog.ShowError(err, window)
+	}
+}
+
+// loadState restores the whole simulator from a snapshot file written by
+// saveState.
+func loadState(f io.ReadCloser) {
+	if f == nil {
+		dialog.ShowError(errors.New("reader is nil"), window)
+		return
+	}
+	defer f.Close()
+
+	s, err := snapshot.Read(f)
+	if err != nil {
+		dialog.ShowError(err, window)
+		return
+	}
+
+	stopSim()
+	simulatorMutex.Lock()
+	err = s.Apply(icmcSimulator)
+	simulatorMutex.Unlock()
+	if err != nil {
+		dialog.ShowError(err, window)
+		return
+	}
+
+	if s.HasCharMap {
+		draw.SetCharData(s.CharMap[:])
+	}
+	draw.SetScreen(s.Screen)
+
+	snapshotMemory()
+	updateAllDisplay()
+}
+
+// saveMemoryMIF writes the processor memory to a code MIF, which can later be
+// opened again. If original is set the code initially loaded is written,
+// otherwise the current data memory, with any changes made while running.
+func saveMemoryMIF(f io.WriteCloser, original bool) {
+	if f == nil {
+		dialog.ShowError(errors.New("writer is nil"), window)
+		return
+	}
+	defer f.Close()
+
+	if icmcSimulator.IsRunning {
+		dialog.ShowError(errors.New("stop the simulation to save it's memory"), window)
+		return
+	}
+
+	simulatorMutex.Lock()
+	mem := icmcSimulator.Data
+	if original {
+		mem = icmcSimulator.Code
+	}
+	simulatorMutex.Unlock()
+
+	words := make([]uint64, len(mem))
+	for i, w := range mem {
+		words[i] = uint64(w)
+	}
+
+	e := MIF.NewEncoder(f)
+	e.Depth = int64(len(words))
+	if err := e.Encode(words); err != nil {
+		dialog.ShowError(err, window)
+	}
+}
+
+// startTrace starts writing an execution trace to a file, in JSON Lines if
+// it's extension is .jsonl or in the binary format otherwise.
+func startTrace(f fyne.URIWriteCloser) {
+	if icmcSimulator.IsRunning {
+		f.Close()
+		dialog.ShowError(errors.New("stop the simulation to start a trace"), window)
+		return
+	}
+
+	format := "binary"
+	if strings.ToLower(f.URI().Extension()) == ".jsonl" {
+		format = "json"
+	}
+
+	tw, err := trace.NewWriter(f, format, traceLimit)
+	if err != nil {
+		f.Close()
+		dialog.ShowError(err, window)
+		return
+	}
+
+	traceWriter = tw
+	icmcSimulator.SetTracer(tw)
+}
+
+// stopTrace stops the current execution trace, flushing it to it's file.
+func stopTrace() {
+	if icmcSimulator.IsRunning {
+		dialog.ShowError(errors.New("stop the simulation to stop the trace"), window)
+		return
+	}
+
+	icmcSimulator.SetTracer(nil)
+	err := traceWriter.Close()
+	traceWriter = nil
+
+	if err != nil {
+		dialog.ShowError(err, window)
+	}
+}
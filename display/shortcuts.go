@@ -11,9 +11,11 @@ import (
 // their counterparts from menuActions.go.
 var (
 	shortOneInst   = desktop.CustomShortcut{KeyName: fyne.KeyTab, Modifier: fyne.KeyModifierControl}
+	shortStepBack  = desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierControl}
 	shortUntilHalt = desktop.CustomShortcut{KeyName: fyne.KeyH, Modifier: fyne.KeyModifierControl}
 	shortReset     = desktop.CustomShortcut{KeyName: fyne.KeyO, Modifier: fyne.KeyModifierControl}
 	shortStop      = desktop.CustomShortcut{KeyName: fyne.KeyP, Modifier: fyne.KeyModifierControl}
+	shortBreak     = desktop.CustomShortcut{KeyName: fyne.KeyB, Modifier: fyne.KeyModifierControl}
 )
 
 // handleShortcuts runs whem every shortcut is triggered, responsible for
@@ -28,12 +30,16 @@ func handleShortcuts(sh fyne.Shortcut) {
 	switch *desktopSh {
 	case shortOneInst:
 		runOneInst()
+	case shortStepBack:
+		stepBack()
 	case shortUntilHalt:
 		runUntilHalt()
 	case shortReset:
 		restartCode()
 	case shortStop:
 		stopSim()
+	case shortBreak:
+		toggleSelectedBreakpoint()
 	default:
 		fmt.Println("invalid shortcut")
 	}
@@ -42,7 +48,9 @@ func handleShortcuts(sh fyne.Shortcut) {
 // setupShortcuts adds all shortcuts from the simulator to a window.
 func setupShortcuts() {
 	window.Canvas().AddShortcut(&shortOneInst, handleShortcuts)
+	window.Canvas().AddShortcut(&shortStepBack, handleShortcuts)
 	window.Canvas().AddShortcut(&shortUntilHalt, handleShortcuts)
 	window.Canvas().AddShortcut(&shortReset, handleShortcuts)
 	window.Canvas().AddShortcut(&shortStop, handleShortcuts)
+	window.Canvas().AddShortcut(&shortBreak, handleShortcuts)
 }
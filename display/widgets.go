@@ -13,34 +13,52 @@ import (
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
+
+	"github.com/lucasgpulcinelli/goICMCsim/MIF"
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+	"github.com/lucasgpulcinelli/goICMCsim/trace"
+)
+
+const (
+	stateExt   = ".icmcstate" // file extension of simulator snapshots
+	traceLimit = 1000000      // maximum instructions written to a trace file
 )
 
 var (
 	registers       [10]*widget.Entry     // registers (plus SP and PC) widgets for editing
+	flagChecks      []*widget.Check       // flag register bits, in the order of processor.AllFlags
 	instructionList *widget.List          // instruction list widgets for editing
 	helpPopUp       *widget.PopUp         // popup that appears to show help
 	periodLabel     *widget.Label         // current clock frequency label
+	countersLabel   *widget.Label         // instructions and cycles run label
+	interruptLabel  *widget.Label         // interrupts enabled and pending label
 	viewMode        int               = 1 // view type of instruction list (-1 -> raw, 1 -> op name)
+	selectedInst    widget.ListItemID     // last instruction list row selected
+	traceWriter     trace.Writer          // current execution trace, nil if not tracing
 )
 
-// validateFileAndShowError checks if a file can be opened and if it's a .mif file.
-// If the file cannot be opened or is not a .mif file, it displays an error to the user.
-func validateFileAndShowError(f fyne.URIReadCloser, err error) {
+// validateFileAndShowError checks if a file can be opened and if it has the
+// extension provided (such as ".mif"). If the file cannot be opened or has
+// another extension, it displays an error to the user and returns false.
+func validateFileAndShowError(f fyne.URIReadCloser, err error, ext string) bool {
 	if err != nil {
 		dialog.ShowError(err, window)
-		return
+		return false
 	}
 
 	if f == nil {
 		dialog.ShowError(errors.New("could not open a file"), window)
-		return
+		return false
 	}
 
-	// Checks if the file has the .mif extension
-	if strings.ToLower(filepath.Ext(f.URI().Path())) != ".mif" {
-		dialog.ShowError(errors.New("file is not a .mif file"), window)
-		return
+	// Checks if the file has the expected extension
+	if strings.ToLower(filepath.Ext(f.URI().Path())) != ext {
+		dialog.ShowError(fmt.Errorf("file is not a %s file", ext), window)
+		f.Close()
+		return false
 	}
+
+	return true
 }
 
 // makeMainMenu adds in window the main menubar with all code actions
@@ -50,21 +68,86 @@ func makeMainMenu() {
 	// a file for either a code or char MIF file)
 	openCodeDialog := dialog.NewFileOpen(
 		func(f fyne.URIReadCloser, err error) {
-			validateFileAndShowError(f, err)
-			fyneReadMIFCode(f)
-
+			if validateFileAndShowError(f, err, ".mif") {
+				fyneReadMIFCode(f)
+			}
 		}, window)
 
 	openCharDialog := dialog.NewFileOpen(
 		func(f fyne.URIReadCloser, err error) {
-			validateFileAndShowError(f, err)
-			fyneReadMIFChar(f)
+			if validateFileAndShowError(f, err, ".mif") {
+				fyneReadMIFChar(f)
+			}
+		}, window)
+
+	// assembly files are assembled and loaded as code in a single step
+	openAsmDialog := dialog.NewFileOpen(
+		func(f fyne.URIReadCloser, err error) {
+			if validateFileAndShowError(f, err, ".asm") {
+				fyneReadAsmCode(f)
+			}
+		}, window)
+
+	// simulator snapshots, saving everything needed to resume a simulation
+	saveStateDialog := dialog.NewFileSave(
+		func(f fyne.URIWriteCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			if f != nil {
+				saveState(f)
+			}
+		}, window)
+	saveStateDialog.SetFileName("state" + stateExt)
+
+	loadStateDialog := dialog.NewFileOpen(
+		func(f fyne.URIReadCloser, err error) {
+			if validateFileAndShowError(f, err, stateExt) {
+				loadState(f)
+			}
+		}, window)
+
+	// memory can be saved as a code MIF, either as it is now or as loaded
+	newSaveMIFDialog := func(original bool) *dialog.FileDialog {
+		d := dialog.NewFileSave(
+			func(f fyne.URIWriteCloser, err error) {
+				if err != nil {
+					dialog.ShowError(err, window)
+					return
+				}
+				if f != nil {
+					saveMemoryMIF(f, original)
+				}
+			}, window)
+		d.SetFileName("code.mif")
+		return d
+	}
+	saveMemoryDialog := newSaveMIFDialog(false)
+	saveCodeDialog := newSaveMIFDialog(true)
+
+	// execution traces are written to a file chosen when starting them
+	traceDialog := dialog.NewFileSave(
+		func(f fyne.URIWriteCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			if f != nil {
+				startTrace(f)
+			}
 		}, window)
+	traceDialog.SetFileName("trace.jsonl")
 
 	// "file" menu toolbar
 	file := fyne.NewMenu("file",
 		fyne.NewMenuItem("open code MIF", func() { openCodeDialog.Show() }),
 		fyne.NewMenuItem("open char MIF", func() { openCharDialog.Show() }),
+		fyne.NewMenuItem("open assembly", func() { openAsmDialog.Show() }),
+		fyne.NewMenuItem("save memory as code MIF", func() { saveMemoryDialog.Show() }),
+		fyne.NewMenuItem("save original code as MIF", func() { saveCodeDialog.Show() }),
+		fyne.NewMenuItem("save state", func() { saveStateDialog.Show() }),
+		fyne.NewMenuItem("load state", func() { loadStateDialog.Show() }),
 	)
 
 	// "options" menu toolbar
@@ -72,8 +155,22 @@ func makeMainMenu() {
 		fyne.NewMenuItem("reset", restartCode),
 		fyne.NewMenuItem("run until halt", runUntilHalt),
 		fyne.NewMenuItem("run one instruction", runOneInst),
+		fyne.NewMenuItem("step back", stepBack),
+		fyne.NewMenuItem("run back to breakpoint", runBackUntilBreakpoint),
 		fyne.NewMenuItem("stop simulation", stopSim),
 		fyne.NewMenuItem("toggle instruction view", toggleInstView),
+		fyne.NewMenuItem("memory viewer", showMemoryView),
+		fyne.NewMenuItem("toggle breakpoint", toggleSelectedBreakpoint),
+		fyne.NewMenuItem("clear breakpoints", clearBreakpoints),
+		fyne.NewMenuItem("watchpoints", showWatchpointsDialog),
+		fyne.NewMenuItem("ISA profile", showProfileDialog),
+		fyne.NewMenuItem("toggle execution trace", func() {
+			if traceWriter != nil {
+				stopTrace()
+			} else {
+				traceDialog.Show()
+			}
+		}),
 	)
 
 	// "help" menu toolbar
@@ -90,10 +187,11 @@ func makeMainMenu() {
 }
 
 // makeClockSlider creates the CanvasObject displaying the clock frequency and
-// with a slider to control it.
+// with a slider to control it, followed by the instruction and cycle counters.
 func makeClockSlider() fyne.CanvasObject {
 	slider := widget.NewSlider(0, 700) // in log scale from 1ns to 10ms (1e7ns)
 	periodLabel = widget.NewLabel("clock: 100.00 MHz")
+	countersLabel = widget.NewLabel(getCountersText())
 
 	slider.OnChanged = func(newValue float64) {
 		period := math.Pow(10, newValue/100)
@@ -101,12 +199,14 @@ func makeClockSlider() fyne.CanvasObject {
 	}
 
 	return container.NewBorder(
-		nil, nil, periodLabel, nil, slider,
+		nil, nil, periodLabel, countersLabel, slider,
 	)
 }
 
 // makeRegisters creates a CanvasObject with all registers (plus SP and PC)
-// stacked vertically, and populates the registers global variable.
+// stacked vertically, followed by the flag register bits and the interrupt
+// state, and populates the registers, flagChecks and interruptLabel global
+// variables.
 func makeRegisters() fyne.CanvasObject {
 	// the stack itself
 	hb := container.NewGridWithColumns(1)
@@ -159,39 +259,240 @@ func makeRegisters() fyne.CanvasObject {
 		))
 	}
 
-	return hb
+	// after the registers, a checkbox for each flag register bit, that can be
+	// toggled while the simulator is stopped
+	flags := container.NewGridWithColumns(2)
+	for _, f := range processor.AllFlags {
+		f := f
+
+		check := widget.NewCheck(f.String(), func(v bool) {
+			if icmcSimulator.IsRunning {
+				return
+			}
+
+			simulatorMutex.Lock()
+			icmcSimulator.SetFlag(f, v)
+			simulatorMutex.Unlock()
+		})
+
+		flagChecks = append(flagChecks, check)
+		flags.Add(check)
+	}
+
+	// interrupts can't be edited, only shown, as they are not in any register
+	interruptLabel = widget.NewLabel(getInterruptText())
+
+	return container.NewVBox(hb, widget.NewLabel("FR:"), flags, interruptLabel)
+}
+
+// updateFlags refreshes the flag register checkboxes with the current value
+// of the flag register, and the interrupt state. SetChecked is not used, as it
+// would call OnChanged and write an old value back to the flag register.
+func updateFlags() {
+	for i, f := range processor.AllFlags {
+		flagChecks[i].Checked = icmcSimulator.GetFlag(f)
+		flagChecks[i].Refresh()
+	}
+	interruptLabel.SetText(getInterruptText())
 }
 
 // makeInstructionScroll creates a CanvasObject with a scrollable list of all
-// instructions in the code loaded.
+// instructions in the code loaded. Each row has a gutter button on the left
+// that toggles a breakpoint at that address.
 func makeInstructionScroll() fyne.CanvasObject {
 	// create a new list with 2^15-1 members, empty by default, and with a certain
 	// update function
 	instructionList = widget.NewList(
 		func() int { return (1 << 15) - 1 },
-		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func() fyne.CanvasObject {
+			gutter := widget.NewButton("  ", nil)
+			gutter.Importance = widget.LowImportance
+			return container.NewHBox(gutter, widget.NewLabel(""))
+		},
 		func(i int, obj fyne.CanvasObject) {
+			row := obj.(*fyne.Container)
+			gutter := row.Objects[0].(*widget.Button)
+
+			// the breakpoint marker and what to do when it is clicked
+			if icmcSimulator.HasBreakpoint(uint16(i)) {
+				gutter.SetText("●")
+			} else {
+				gutter.SetText("  ")
+			}
+			gutter.OnTapped = func() { toggleBreakpoint(i) }
+
 			// get the mnemonic for that instruction, and display it besides it's
 			// location
 
 			mnemonic := icmcSimulator.GetMnemonic(i, viewMode)
 			finalS := fmt.Sprintf("%.5d | %s", i, mnemonic)
 
-			obj.(*widget.Label).SetText(finalS)
+			row.Objects[1].(*widget.Label).SetText(finalS)
 		},
 	)
 
+	instructionList.OnSelected = func(id widget.ListItemID) {
+		selectedInst = id
+	}
+
 	return instructionList
 }
 
+// showWatchpointsDialog shows a dialog to list, add and remove memory
+// watchpoints. Watchpoints can only be changed while the simulator is stopped.
+func showWatchpointsDialog() {
+	if icmcSimulator.IsRunning {
+		dialog.ShowError(errors.New("stop the simulation to edit watchpoints"), window)
+		return
+	}
+
+	kinds := map[string]processor.WatchKind{
+		"read":       processor.WatchRead,
+		"write":      processor.WatchWrite,
+		"read/write": processor.WatchReadWrite,
+	}
+
+	startEntry := widget.NewEntry()
+	startEntry.SetPlaceHolder("start address")
+	endEntry := widget.NewEntry()
+	endEntry.SetPlaceHolder("end address (optional)")
+	kindSelect := widget.NewSelect([]string{"read", "write", "read/write"}, nil)
+	kindSelect.SetSelected("write")
+
+	var list *widget.List
+	list = widget.NewList(
+		func() int { return len(icmcSimulator.Watchpoints()) },
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, nil,
+				widget.NewButton("remove", nil), widget.NewLabel(""),
+			)
+		},
+		func(i int, obj fyne.CanvasObject) {
+			row := obj.(*fyne.Container)
+			for _, o := range row.Objects {
+				switch o := o.(type) {
+				case *widget.Label:
+					o.SetText(icmcSimulator.Watchpoints()[i].String())
+				case *widget.Button:
+					o.OnTapped = func() {
+						icmcSimulator.RemoveWatchpoint(i)
+						list.Refresh()
+					}
+				}
+			}
+		},
+	)
+
+	add := widget.NewButton("add", func() {
+		start, err := strconv.ParseUint(startEntry.Text, 10, 15)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("invalid start address: %v", err), window)
+			return
+		}
+		end := start
+		if endEntry.Text != "" {
+			if end, err = strconv.ParseUint(endEntry.Text, 10, 15); err != nil {
+				dialog.ShowError(fmt.Errorf("invalid end address: %v", err), window)
+				return
+			}
+		}
+
+		err = icmcSimulator.AddWatchpoint(processor.Watchpoint{
+			Start: uint16(start), End: uint16(end), Kind: kinds[kindSelect.Selected],
+		})
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		list.Refresh()
+	})
+
+	form := container.NewVBox(
+		container.NewGridWithColumns(3, startEntry, endEntry, kindSelect),
+		add,
+	)
+
+	d := dialog.NewCustom("watchpoints", "close",
+		container.NewBorder(form, nil, nil, nil, list), window,
+	)
+	d.Resize(fyne.NewSize(500, 400))
+	d.Show()
+}
+
+// showProfileDialog shows a dialog to choose the ISA profile, describing what
+// each one is meant to match.
+func showProfileDialog() {
+	if icmcSimulator.IsRunning {
+		dialog.ShowError(errors.New("stop the simulation to change the profile"), window)
+		return
+	}
+
+	descriptions := widget.NewLabel("")
+	lines := make([]string, len(processor.Profiles))
+	for i, p := range processor.Profiles {
+		lines[i] = fmt.Sprintf("%s: %s", p.Name, p.Description)
+	}
+	descriptions.SetText(strings.Join(lines, "\n"))
+
+	radio := widget.NewRadioGroup(processor.ProfileNames(), func(name string) {
+		p, err := processor.ProfileByName(name)
+		if err != nil {
+			return
+		}
+
+		simulatorMutex.Lock()
+		icmcSimulator.SetProfile(p)
+		simulatorMutex.Unlock()
+
+		// the overflow flag may now be shown from the carry or on it's own
+		updateFlags()
+	})
+	radio.SetSelected(icmcSimulator.GetProfile().Name)
+	radio.Required = true
+
+	d := dialog.NewCustom("ISA profile", "close",
+		container.NewVBox(radio, descriptions), window,
+	)
+	d.Show()
+}
+
+// showMIFErrors shows every error and warning found while parsing a MIF in a
+// single scrollable dialog. Other errors are shown as usual.
+func showMIFErrors(err error, name string) {
+	el, ok := err.(MIF.ErrorList)
+	if !ok {
+		dialog.ShowError(err, window)
+		return
+	}
+
+	lines := make([]string, len(el))
+	for i, e := range el {
+		lines[i] = e.Error()
+	}
+
+	title := fmt.Sprintf("%d problems in %s", len(el), name)
+	if !el.HasErrors() {
+		title = fmt.Sprintf("%d warnings in %s", len(el), name)
+	}
+
+	text := widget.NewLabel(strings.Join(lines, "\n"))
+	text.TextStyle.Monospace = true
+
+	d := dialog.NewCustom(title, "close", container.NewScroll(text), window)
+	d.Resize(fyne.NewSize(700, 400))
+	d.Show()
+}
+
 // makeHelpPopUp creates the popup that will appear when the user presses the
 // menu button for help.
 func makeHelpPopUp() {
 	help := widget.NewLabel(`
   Ctrl+Tab runs a single instruction;
+  Ctrl+Z steps back a single instruction;
   Ctrl+H runs instructions until a halt, breakp or error is found;
   Ctrl+P stops execution of a simulation;
-  Ctrl+O resets the simulator.
+  Ctrl+O resets the simulator;
+  Ctrl+B toggles a breakpoint at the selected instruction.
   `)
 	ok := widget.NewButton("ok", func() { helpPopUp.Hide() })
 
@@ -219,7 +520,11 @@ func updateAllDisplay() {
 		reg.SetText(fmt.Sprintf("%d", v)) // displays registers value on the left vertical table
 
 	}
+	updateFlags()
+	countersLabel.SetText(getCountersText())
 
 	instructionList.Select(widget.ListItemID(icmcSimulator.PC))
 	instructionList.ScrollTo(widget.ListItemID(icmcSimulator.PC))
+
+	refreshMemoryView()
 }
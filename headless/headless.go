@@ -0,0 +1,320 @@
+// package headless implements a command line runner for the ICMC simulator,
+// executing a code MIF without opening any window. It is meant for CI boxes,
+// SSH sessions and automatic grading of programs.
+package headless
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucasgpulcinelli/goICMCsim/MIF"
+	"github.com/lucasgpulcinelli/goICMCsim/assembler"
+	"github.com/lucasgpulcinelli/goICMCsim/devices"
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+	"github.com/lucasgpulcinelli/goICMCsim/trace"
+)
+
+// exit codes returned by Main.
+const (
+	ExitHalt    = 0 // the program reached a halt instruction
+	ExitRuntime = 1 // the processor returned an error or the time limit was hit
+	ExitUsage   = 2 // the command line or the MIF files are invalid
+)
+
+const (
+	sw = 40 // screen width
+	sh = 30 // screen height
+)
+
+// Runner holds the state of a single headless execution: the processor
+// itself, the virtual screen written by outchar and the input fed to inchar.
+type Runner struct {
+	Proc   *processor.ICMCProcessor
+	Screen [sh][sw]uint16 // the characters drawn, color in the higher byte
+
+	input []byte // the keys inchar will read, in order
+}
+
+// NewRunner creates a runner whose inchar hook reads from input, one byte per
+// call, and returns 255 (no key pressed) once the input is exhausted.
+func NewRunner(input []byte) *Runner {
+	r := &Runner{input: input}
+	r.Proc = processor.NewEmptyProcessor(r.inChar, r.outChar)
+	return r
+}
+
+func (r *Runner) inChar() (uint8, error) {
+	if len(r.input) == 0 {
+		return 255, nil
+	}
+	c := r.input[0]
+	r.input = r.input[1:]
+	return c, nil
+}
+
+// outChar mirrors draw.FyneOutChar, including its bounds checks, so that a
+// program fails headless in the same places it would fail in the GUI.
+func (r *Runner) outChar(c, pos uint16) error {
+	if pos >= sh*sw {
+		return fmt.Errorf("invalid position to draw on")
+	}
+	if byte(c) > 127 || byte(c>>8) > 16 {
+		return fmt.Errorf("invalid character to print")
+	}
+
+	r.Screen[pos/sw][pos%sw] = c
+	return nil
+}
+
+// LoadCode reads a code MIF and loads it into the processor, resetting it.
+func (r *Runner) LoadCode(rd io.Reader) error {
+	p := MIF.NewParser(rd)
+	if err := p.Parse(); err != nil {
+		return err
+	}
+
+	width, depth := p.GetDimensions()
+	if width != 16 || depth != 1<<15 {
+		return fmt.Errorf("the MIF is not the right size for code: width %d, depth %d",
+			width, depth)
+	}
+
+	for i, w := range p.GetWords() {
+		r.Proc.Code[i] = uint16(w)
+	}
+	r.Proc.Reset()
+	return nil
+}
+
+// LoadAsm assembles an assembly source and loads it into the processor,
+// resetting it.
+func (r *Runner) LoadAsm(rd io.Reader) error {
+	words, err := assembler.Assemble(rd)
+	if err != nil {
+		return err
+	}
+
+	copy(r.Proc.Code[:], words)
+	r.Proc.Reset()
+	return nil
+}
+
+// Run executes the loaded program until a halt or an error. Breakpoints
+// (breakp) do not stop a headless run, execution just continues after them.
+// If timeout is not zero, the run is stopped with an error after that long.
+func (r *Runner) Run(timeout time.Duration) error {
+	var period time.Duration
+
+	var timedOut, finished atomic.Bool
+	defer finished.Store(true)
+	if timeout != 0 {
+		timer := time.AfterFunc(timeout, func() {
+			timedOut.Store(true)
+
+			// Stop only ends a run going on, and the processor may be between
+			// the runs done for each breakpoint
+			for !r.Proc.Stop() && !finished.Load() {
+				time.Sleep(time.Millisecond)
+			}
+		})
+		defer timer.Stop()
+	}
+
+	for {
+		if timedOut.Load() {
+			return fmt.Errorf("time limit of %v exceeded", timeout)
+		}
+		if err := r.Proc.RunUntilHalt(&period); err != nil {
+			return err
+		}
+		if processor.Opcode(r.Proc.Data[r.Proc.PC]>>10) == processor.OpHALT {
+			return nil
+		}
+	}
+}
+
+// ScreenText returns the virtual screen as text, one line per row, without
+// trailing blanks. Non printable characters are shown as spaces.
+func (r *Runner) ScreenText() string {
+	var lines []string
+
+	for i := 0; i < sh; i++ {
+		var b strings.Builder
+		for j := 0; j < sw; j++ {
+			c := byte(r.Screen[i][j])
+			if c < ' ' || c > '~' {
+				c = ' '
+			}
+			b.WriteByte(c)
+		}
+		lines = append(lines, strings.TrimRight(b.String(), " "))
+	}
+
+	// remove empty lines at the bottom of the screen
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Main implements the "run" subcommand given its arguments (without the
+// subcommand name itself), and returns the process exit code.
+func Main(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	codeMIF := fs.String("codemif", "", "code MIF file to run")
+	asmFile := fs.String("asm", "", "assembly file to assemble and run, instead of a code MIF")
+	charMIF := fs.String("charmif", "", "character MIF file, only validated because the screen is printed as text")
+	input := fs.String("input", "", "characters read by inchar, in order")
+	timeout := fs.Duration("timeout", 0, "stop with an error after this long (0 means no limit)")
+	showScreen := fs.Bool("screen", true, "print the screen contents when the run ends")
+	traceFile := fs.String("trace", "", "write an execution trace to this file")
+	traceFormat := fs.String("trace-format", "json", "execution trace format: json (JSON Lines) or binary")
+	traceLimit := fs.Uint64("trace-limit", 1000000, "maximum instructions written to the trace (0 means no limit)")
+	profileName := fs.String("profile", "default", "ISA profile, one of: "+strings.Join(processor.ProfileNames(), ", "))
+	timerAddr := fs.Int("timer", -1, "map a programmable timer to the 4 words from this address (-1 means no timer)")
+	toneAddr := fs.Int("tone", -1, "map a tone generator to the 4 words from this address (-1 means no tone generator)")
+	wavFile := fs.String("wav", "", "write the sound of the tone generator to this WAV file")
+
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if (*codeMIF == "") == (*asmFile == "") {
+		fmt.Fprintln(os.Stderr, "run: exactly one of -codemif or -asm is required")
+		fs.Usage()
+		return ExitUsage
+	}
+
+	profile, err := processor.ProfileByName(*profileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "run: %v\n", err)
+		return ExitUsage
+	}
+
+	r := NewRunner([]byte(*input))
+	r.Proc.SetProfile(profile)
+
+	if *timerAddr >= 0 {
+		if _, err := devices.MapTimer(r.Proc, *timerAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "run: %v\n", err)
+			return ExitUsage
+		}
+	}
+
+	var tone *devices.Tone
+	if *toneAddr >= 0 {
+		if tone, err = devices.MapTone(r.Proc, *toneAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "run: %v\n", err)
+			return ExitUsage
+		}
+	}
+	if *wavFile != "" {
+		if tone == nil {
+			fmt.Fprintln(os.Stderr, "run: -wav requires -tone")
+			return ExitUsage
+		}
+		tone.Record = true
+	}
+
+	codeFile, load := *codeMIF, r.LoadCode
+	if *asmFile != "" {
+		codeFile, load = *asmFile, r.LoadAsm
+	}
+	if err := loadFile(codeFile, load); err != nil {
+		fmt.Fprintf(os.Stderr, "error reading %s: %v\n", codeFile, err)
+		return ExitUsage
+	}
+	if *charMIF != "" {
+		if err := loadFile(*charMIF, checkCharMIF); err != nil {
+			fmt.Fprintf(os.Stderr, "error reading %s: %v\n", *charMIF, err)
+			return ExitUsage
+		}
+	}
+
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error creating %s: %v\n", *traceFile, err)
+			return ExitUsage
+		}
+
+		tw, err := trace.NewWriter(f, *traceFormat, *traceLimit)
+		if err != nil {
+			f.Close()
+			fmt.Fprintf(os.Stderr, "run: %v\n", err)
+			return ExitUsage
+		}
+		defer func() {
+			if err := tw.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "error writing %s: %v\n", *traceFile, err)
+			}
+		}()
+
+		r.Proc.SetTracer(tw)
+	}
+
+	err = r.Run(*timeout)
+
+	// the sound is written even if the program failed, to hear what it did
+	if *wavFile != "" {
+		if werr := writeWAV(*wavFile, tone.Notes()); werr != nil {
+			fmt.Fprintf(os.Stderr, "error writing %s: %v\n", *wavFile, werr)
+		}
+	}
+
+	if *showScreen {
+		if s := r.ScreenText(); s != "" {
+			fmt.Println(s)
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "runtime error at PC %d after %d instructions: %v\n",
+			r.Proc.PC, r.Proc.InstCount, err)
+		return ExitRuntime
+	}
+	return ExitHalt
+}
+
+// loadFile opens a file and passes it to a loading function.
+func loadFile(name string, load func(io.Reader) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return load(f)
+}
+
+// writeWAV creates a WAV file with a sequence of notes.
+func writeWAV(name string, notes []devices.Note) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err = devices.WriteWAV(f, notes); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// checkCharMIF validates a character mapping MIF the same way the GUI does.
+func checkCharMIF(rd io.Reader) error {
+	p := MIF.NewParser(rd)
+	if err := p.Parse(); err != nil {
+		return err
+	}
+	// the size is checked before the data is allocated, as DEPTH can be huge
+	if width, depth := p.GetDimensions(); (width+7)/8*depth != 1<<10 {
+		return fmt.Errorf("the MIF is not the correct size for char: %d bytes",
+			(width+7)/8*depth)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package headless
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeAsm writes an assembly source to a temporary file, returning it's name.
+func writeAsm(t *testing.T, src string) string {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "prog.asm")
+	if err := os.WriteFile(name, []byte(src), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return name
+}
+
+func TestMainExitCodes(t *testing.T) {
+	halt := writeAsm(t, "loadn r0, #1\nhalt\n")
+	divZero := writeAsm(t, "loadn r0, #1\nloadn r1, #0\ndiv r2, r0, r1\nhalt\n")
+	loop := writeAsm(t, "loop:\njmp loop\n")
+	invalid := writeAsm(t, "loadn r0\n")
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"halt", []string{"-asm", halt}, ExitHalt},
+		{"runtime error", []string{"-asm", divZero, "-profile", "strict"}, ExitRuntime},
+		{"timeout", []string{"-asm", loop, "-timeout", "50ms"}, ExitRuntime},
+		{"no program", nil, ExitUsage},
+		{"unknown flag", []string{"-asm", halt, "-nope"}, ExitUsage},
+		{"unknown profile", []string{"-asm", halt, "-profile", "nope"}, ExitUsage},
+		{"missing file", []string{"-asm", filepath.Join(t.TempDir(), "none.asm")}, ExitUsage},
+		{"invalid program", []string{"-asm", invalid}, ExitUsage},
+		{"wav without tone", []string{"-asm", halt, "-wav", "out.wav"}, ExitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-screen=false"}, tt.args...)
+			if got := Main(args); got != tt.want {
+				t.Errorf("Main(%q) = %d, want %d", args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	r := NewRunner(nil)
+	if err := r.LoadAsm(strings.NewReader("loop:\njmp loop\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// with the race detector, a timeout stopping the processor from another
+	// goroutine must be synchronized
+	if err := r.Run(20 * time.Millisecond); err == nil {
+		t.Errorf("endless loop ran without a timeout error")
+	}
+}
+
+func TestMainWAV(t *testing.T) {
+	prog := writeAsm(t, "loadn r0, #440\nstore 2000, r0\nloadn r0, #10\n"+
+		"store 2001, r0\nstore 2003, r0\nhalt\n")
+	wav := filepath.Join(t.TempDir(), "out.wav")
+
+	if got := Main([]string{"-screen=false", "-asm", prog, "-tone", "2000",
+		"-wav", wav}); got != ExitHalt {
+		t.Fatalf("Main returned %d, want %d", got, ExitHalt)
+	}
+
+	// a 44 byte header and the samples of the 10ms note
+	info, err := os.Stat(wav)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Size() <= 44 {
+		t.Errorf("WAV file with %d bytes, the note was not recorded", info.Size())
+	}
+}
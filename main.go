@@ -5,8 +5,12 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
 
+	"github.com/lucasgpulcinelli/goICMCsim/devices"
 	"github.com/lucasgpulcinelli/goICMCsim/display"
+	"github.com/lucasgpulcinelli/goICMCsim/headless"
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
 	"net/http"
 	_ "net/http/pprof"
 )
@@ -14,6 +18,12 @@ import (
 var (
 	initialCode = flag.String("codemif", "", "code MIF file to use at startup")
 	initialChar = flag.String("charmif", "", "character MIF file to use at startup")
+	profileName = flag.String("profile", "default", "ISA profile, one of: "+
+		strings.Join(processor.ProfileNames(), ", "))
+	timerAddr = flag.Int("timer", -1, "map a programmable timer to the 4 "+
+		"words from this address (-1 means no timer)")
+	toneAddr = flag.Int("tone", -1, "map a tone generator to the 4 words "+
+		"from this address (-1 means no tone generator)")
 )
 
 // getFiles reads from the command line flags provided both the initial code MIF
@@ -40,9 +50,46 @@ func getFiles() (codem, charm io.ReadCloser) {
 }
 
 func main() {
+	// "goICMCsim run [flags]" executes a program without opening any window
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		os.Exit(headless.Main(os.Args[2:]))
+	}
+
 	go func() {
 		http.ListenAndServe("localhost:6060", nil)
 	}()
 	codem, charm := getFiles()
-	display.StartSimulatorWindow(codem, charm)
+
+	profile, err := processor.ProfileByName(*profileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var player *devices.HostPlayer
+	display.StartSimulatorWindow(codem, charm, func(pr *processor.ICMCProcessor) {
+		pr.SetProfile(profile)
+		if *timerAddr >= 0 {
+			if _, err := devices.MapTimer(pr, *timerAddr); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if *toneAddr >= 0 {
+			tone, err := devices.MapTone(pr, *toneAddr)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			// without a player, programs still run, just without sound
+			if player, err = devices.NewHostPlayer(); err != nil {
+				log.Printf("no sound output: %v\n", err)
+			} else {
+				tone.OnPlay = player.Play
+			}
+		}
+	})
+
+	if player != nil {
+		player.Close()
+	}
 }
@@ -77,12 +77,12 @@ func genMOVM(d uint16) string {
 // function and the information if the instruction uses the carry bit.
 func execALU(withCarry bool, operation ALUOpFunc) func(*ICMCProcessor) error {
 	return func(pr *ICMCProcessor) error {
-		inst := pr.Data[pr.PC]
+		inst := pr.cur.word
 
 		// get the operands
-		RD := getRegAt(inst, 7)
-		RS1 := getRegAt(inst, 4)
-		RS2 := getRegAt(inst, 1)
+		RD := pr.cur.rd
+		RS1 := pr.cur.rs1
+		RS2 := pr.cur.rs2
 
 		// execute the operation itself (using uint32s, because the result might
 		// overflow a uint16)
@@ -105,23 +105,77 @@ func execALU(withCarry bool, operation ALUOpFunc) func(*ICMCProcessor) error {
 	}
 }
 
+// execDIVOp, execMODOp and execMULTOp do the actual operation for execDIV,
+// execMOD and execMULT.
+var (
+	execDIVOp  = execALU(true, func(a, b uint32) uint32 { return a / b })
+	execMODOp  = execALU(false, func(a, b uint32) uint32 { return a % b })
+	execMULTOp = execALU(true, func(a, b uint32) uint32 { return a * b })
+)
+
+// execMULT executes a multiplication. If the profile has a separate overflow
+// flag, a result that does not fit sets overflow instead of carry, which is
+// left unchanged.
+func execMULT(pr *ICMCProcessor) error {
+	if !pr.profile.SeparateOverflow {
+		return execMULTOp(pr)
+	}
+
+	oldCarry := pr.fr & carry
+	err := execMULTOp(pr)
+
+	if pr.fr&carry != 0 {
+		pr.fr |= overflow
+	} else {
+		pr.fr &= ^overflow
+	}
+	pr.fr = pr.fr&^carry | oldCarry
+	return err
+}
+
+// divByZero handles a division or modulo by zero as the profile tells,
+// setting the divZero flag.
+func (pr *ICMCProcessor) divByZero() error {
+	pr.fr |= divZero
+
+	switch pr.profile.DivZero {
+	case DivZeroClear:
+		RD := pr.cur.rd
+		pr.GPRRegs[RD] = 0
+	case DivZeroError:
+		return fmt.Errorf("division by zero")
+	}
+	return nil
+}
+
 // execDIV executes a division in the ICMCProcessor, beeing unique among
-// ALU-like functions because it sets the divZero flag state
+// ALU-like functions (together with execMOD) because it sets the divZero flag
+// state. What a division by zero does depends on the profile.
 func execDIV(pr *ICMCProcessor) error {
-	RS2 := getRegAt(pr.Data[pr.PC], 1)
+	RS2 := pr.cur.rs2
 	if pr.GPRRegs[RS2] == 0 {
-		pr.fr &= divZero
-		return nil
+		return pr.divByZero()
 	}
 
-	execALU(true, func(a, b uint32) uint32 { return a / b })(pr)
-	return nil
+	pr.fr &= ^divZero
+	return execDIVOp(pr)
+}
+
+// execMOD executes a modulo operation, with the same divZero handling as
+// execDIV.
+func execMOD(pr *ICMCProcessor) error {
+	RS2 := pr.cur.rs2
+	if pr.GPRRegs[RS2] == 0 {
+		return pr.divByZero()
+	}
+
+	pr.fr &= ^divZero
+	return execMODOp(pr)
 }
 
 func execNOT(pr *ICMCProcessor) error {
-	inst := pr.Data[pr.PC]
-	RD := getRegAt(inst, 7)
-	RS1 := getRegAt(inst, 4)
+	RD := pr.cur.rd
+	RS1 := pr.cur.rs1
 
 	pr.GPRRegs[RD] = ^pr.GPRRegs[RS1]
 
@@ -130,9 +184,9 @@ func execNOT(pr *ICMCProcessor) error {
 
 func execINCDEC(pr *ICMCProcessor) error {
 	var result uint32
-	inst := pr.Data[pr.PC]
+	inst := pr.cur.word
 
-	RD := getRegAt(inst, 7)
+	RD := pr.cur.rd
 
 	if inst&(1<<6) != 0 {
 		// if we are decrementing
@@ -149,8 +203,8 @@ func execINCDEC(pr *ICMCProcessor) error {
 }
 
 func execROTSH(pr *ICMCProcessor) error {
-	inst := pr.Data[pr.PC]
-	RD := getRegAt(inst, 7)
+	inst := pr.cur.word
+	RD := pr.cur.rd
 
 	// operand of bits to shift/rotate
 	n := inst & 0b1111
@@ -174,25 +228,25 @@ func execROTSH(pr *ICMCProcessor) error {
 	case 6, 7:
 		lower := (pr.GPRRegs[RD] >> n)
 		upper := pr.GPRRegs[RD] & ((1 << n) - 1)
-		upper = upper << n
+		upper = upper << (16 - n)
 		pr.GPRRegs[RD] = upper + lower
 	}
 	return nil
 }
 
 func execMOV(pr *ICMCProcessor) error {
-	inst := pr.Data[pr.PC]
+	inst := pr.cur.word
 
 	// special cases are needed to handle mov sp, rx or mov rx, sp
 	if inst&0b11 == 0b11 {
-		RS := getRegAt(inst, 7)
+		RS := pr.cur.rd
 		pr.SP = pr.GPRRegs[RS]
 	} else if inst&1 == 1 {
-		RD := getRegAt(inst, 7)
+		RD := pr.cur.rd
 		pr.GPRRegs[RD] = pr.SP
 	} else {
-		RD := getRegAt(inst, 7)
-		RS := getRegAt(inst, 4)
+		RD := pr.cur.rd
+		RS := pr.cur.rs1
 		pr.GPRRegs[RD] = pr.GPRRegs[RS]
 	}
 
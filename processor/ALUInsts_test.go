@@ -0,0 +1,178 @@
+package processor
+
+import "testing"
+
+func TestALU(t *testing.T) {
+	runPrograms(t, []testProgram{
+		{
+			name: "add",
+			prog: prog(loadn(1, 3), loadn(2, 4), rrr(OpADD, 0, 1, 2)),
+			regs: map[int]uint16{0: 7}, flagsClear: zero | carry | negative,
+		},
+		{
+			name: "add overflow sets carry and zero",
+			prog: prog(loadn(1, 0xffff), loadn(2, 1), rrr(OpADD, 0, 1, 2)),
+			regs: map[int]uint16{0: 0}, flagsSet: zero | carry,
+		},
+		{
+			name: "addc uses carry",
+			prog: prog(loadn(1, 0xffff), loadn(2, 1), rrr(OpADD, 0, 1, 2),
+				carryBit(rrr(OpADD, 3, 2, 2))),
+			regs: map[int]uint16{3: 3},
+		},
+		{
+			name: "addc without carry",
+			prog: prog(loadn(1, 1), loadn(2, 1), carryBit(rrr(OpADD, 3, 1, 2))),
+			regs: map[int]uint16{3: 2},
+		},
+		{
+			name: "add carry variant bit ignored without carry op",
+			prog: prog(loadn(1, 0xffff), loadn(2, 1), rrr(OpADD, 0, 1, 2),
+				rrr(OpADD, 3, 2, 2)),
+			regs: map[int]uint16{3: 2},
+		},
+		{
+			name: "sub",
+			prog: prog(loadn(1, 10), loadn(2, 4), rrr(OpSUB, 0, 1, 2)),
+			regs: map[int]uint16{0: 6}, flagsClear: zero | carry | negative,
+		},
+		{
+			name: "sub borrow sets carry and negative",
+			prog: prog(loadn(1, 4), loadn(2, 10), rrr(OpSUB, 0, 1, 2)),
+			regs: map[int]uint16{0: 0xfffa}, flagsSet: carry | negative,
+		},
+		{
+			name: "sub to zero",
+			prog: prog(loadn(1, 4), loadn(2, 4), rrr(OpSUB, 0, 1, 2)),
+			regs: map[int]uint16{0: 0}, flagsSet: zero, flagsClear: carry,
+		},
+		{
+			name: "mult",
+			prog: prog(loadn(1, 300), loadn(2, 3), rrr(OpMULT, 0, 1, 2)),
+			regs: map[int]uint16{0: 900}, flagsClear: carry,
+		},
+		{
+			name: "mult overflow",
+			prog: prog(loadn(1, 300), loadn(2, 300), rrr(OpMULT, 0, 1, 2)),
+			regs: map[int]uint16{0: uint16(90000 & 0xffff)}, flagsSet: carry,
+		},
+		{
+			name: "div",
+			prog: prog(loadn(1, 17), loadn(2, 5), rrr(OpDIV, 0, 1, 2)),
+			regs: map[int]uint16{0: 3}, flagsClear: divZero,
+		},
+		{
+			name: "div by zero sets divZero and keeps the destination",
+			prog: prog(loadn(0, 42), loadn(1, 17), rrr(OpDIV, 0, 1, 2)),
+			regs: map[int]uint16{0: 42}, flagsSet: divZero,
+		},
+		{
+			name: "div clears divZero",
+			prog: prog(loadn(1, 17), rrr(OpDIV, 0, 1, 2), loadn(2, 2),
+				rrr(OpDIV, 0, 1, 2)),
+			regs: map[int]uint16{0: 8}, flagsClear: divZero,
+		},
+		{
+			name: "mod",
+			prog: prog(loadn(1, 17), loadn(2, 5), rrr(OpMOD, 0, 1, 2)),
+			regs: map[int]uint16{0: 2},
+		},
+		{
+			name: "mod by zero sets divZero",
+			prog: prog(loadn(0, 42), loadn(1, 17), rrr(OpMOD, 0, 1, 2)),
+			regs: map[int]uint16{0: 42}, flagsSet: divZero,
+		},
+		{
+			name: "and",
+			prog: prog(loadn(1, 0b1100), loadn(2, 0b1010), rrr(OpAND, 0, 1, 2)),
+			regs: map[int]uint16{0: 0b1000},
+		},
+		{
+			name: "or",
+			prog: prog(loadn(1, 0b1100), loadn(2, 0b1010), rrr(OpOR, 0, 1, 2)),
+			regs: map[int]uint16{0: 0b1110},
+		},
+		{
+			name: "xor",
+			prog: prog(loadn(1, 0b1100), loadn(2, 0b1010), rrr(OpXOR, 0, 1, 2)),
+			regs: map[int]uint16{0: 0b0110},
+		},
+		{
+			name: "xor to zero",
+			prog: prog(loadn(1, 0x1234), rrr(OpXOR, 0, 1, 1)),
+			regs: map[int]uint16{0: 0}, flagsSet: zero,
+		},
+		{
+			name: "not",
+			prog: prog(loadn(1, 0x00ff), rr(OpNOT, 0, 1)),
+			regs: map[int]uint16{0: 0xff00},
+		},
+		{
+			name: "inc",
+			prog: prog(loadn(0, 41), r(OpINCDEC, 0, 0)),
+			regs: map[int]uint16{0: 42}, flagsClear: zero,
+		},
+		{
+			name: "inc wraps to zero",
+			prog: prog(loadn(0, 0xffff), r(OpINCDEC, 0, 0)),
+			regs: map[int]uint16{0: 0}, flagsSet: zero,
+		},
+		{
+			name: "dec",
+			prog: prog(loadn(0, 1), r(OpINCDEC, 0, 1<<6)),
+			regs: map[int]uint16{0: 0}, flagsSet: zero,
+		},
+		{
+			name: "dec to negative",
+			prog: prog(r(OpINCDEC, 5, 1<<6)),
+			regs: map[int]uint16{5: 0xffff}, flagsSet: negative,
+		},
+		{
+			name: "mov",
+			prog: prog(loadn(1, 1234), rr(OpMOV, 0, 1)),
+			regs: map[int]uint16{0: 1234},
+		},
+		{
+			name: "mov sp, rx",
+			prog: prog(loadn(3, 1000), r(OpMOV, 3, 0b11)),
+			sp:   u16(1000),
+		},
+		{
+			name: "mov rx, sp",
+			prog: prog(r(OpMOV, 4, 0b01)),
+			regs: map[int]uint16{4: (1 << 15) - 1},
+		},
+	})
+}
+
+func TestRotateShift(t *testing.T) {
+	tests := []struct {
+		name   string
+		kind   uint16
+		n      uint16
+		in     uint16
+		result uint16
+	}{
+		{"shiftl0", 0, 4, 0x1234, 0x2340},
+		{"shiftl1", 1, 4, 0x1234, 0x234f},
+		{"shiftr0", 2, 4, 0x1234, 0x0123},
+		{"shiftr1", 3, 4, 0x1234, 0xf123},
+		{"rotl", 4, 4, 0x1234, 0x2341},
+		{"rotl alias", 5, 1, 0x8001, 0x0003},
+		{"rotl by zero", 4, 0, 0x1234, 0x1234},
+		{"rotr", 6, 4, 0x1234, 0x4123},
+		{"rotr alias", 7, 1, 0x8001, 0xc000},
+		{"rotr by zero", 6, 0, 0x1234, 0x1234},
+		{"rotr by 15", 6, 15, 0x0001, 0x0002},
+	}
+
+	var tps []testProgram
+	for _, tt := range tests {
+		tps = append(tps, testProgram{
+			name: tt.name,
+			prog: prog(loadn(2, tt.in), r(OpROTSH, 2, tt.kind<<4|tt.n)),
+			regs: map[int]uint16{2: tt.result},
+		})
+	}
+	runPrograms(t, tps)
+}
@@ -0,0 +1,71 @@
+package processor_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lucasgpulcinelli/goICMCsim/assembler"
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+)
+
+// BenchmarkRun runs the programs in testdata/bench until they halt, reporting
+// how many instructions are executed per second.
+func BenchmarkRun(b *testing.B) {
+	files, err := filepath.Glob(filepath.Join("testdata", "bench", "*.asm"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, file := range files {
+		file := file
+		b.Run(filepath.Base(file), func(b *testing.B) {
+			src, err := os.Open(file)
+			if err != nil {
+				b.Fatal(err)
+			}
+			words, err := assembler.Assemble(src)
+			src.Close()
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			pr := processor.NewEmptyProcessor(nil, nil)
+			copy(pr.Code[:], words)
+
+			var period time.Duration
+			var insts uint64
+			start := time.Now()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				pr.Reset()
+				pr.InstCount = 0
+				if err := pr.RunUntilHalt(&period); err != nil {
+					b.Fatal(err)
+				}
+				insts += pr.InstCount
+			}
+
+			b.ReportMetric(float64(insts)/time.Since(start).Seconds(), "inst/s")
+		})
+	}
+}
+
+// BenchmarkGetMnemonic disassembles the whole memory, as the instruction list
+// does when scrolled through.
+func BenchmarkGetMnemonic(b *testing.B) {
+	pr := processor.NewEmptyProcessor(nil, nil)
+	for i := range pr.Code {
+		pr.Code[i] = uint16(i * 7919)
+	}
+	pr.Reset()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for loc := 0; loc < len(pr.Data); loc += 64 {
+			pr.GetMnemonic(loc, 0)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package processor
+
+import "fmt"
+
+// Device is a peripheral mapped to a range of Data addresses, accessed by
+// load, store, loadi and storei instead of the words of Data in that range.
+// Offsets are relative to the start of the range the device is mapped to.
+// Devices that also implement Ticker can raise interrupts.
+type Device interface {
+	Read(offset uint16) (uint16, error)
+	Write(offset, v uint16) error
+
+	// Reset returns the device to it's initial state, called when the
+	// processor is reset.
+	Reset()
+}
+
+// StatefulDevice is a Device whose state can be saved and restored, such as
+// in snapshots. Devices that are not stateful can't be saved.
+type StatefulDevice interface {
+	Device
+
+	// State returns every value needed to restore the device.
+	State() []uint16
+
+	// ValidateState returns the error SetState would fail with for a state,
+	// without changing the device.
+	ValidateState(state []uint16) error
+
+	// SetState restores a state returned by State, failing if it is invalid.
+	// Nothing is changed when it fails.
+	SetState(state []uint16) error
+}
+
+// DeviceMapping is a device and the inclusive range of addresses it is mapped
+// to.
+type DeviceMapping struct {
+	Start  uint16
+	End    uint16
+	Device Device
+}
+
+func (m DeviceMapping) String() string {
+	return fmt.Sprintf("%.5d..%.5d (%T)", m.Start, m.End, m.Device)
+}
+
+// MapDevice maps a device to the inclusive range of addresses from start to
+// end, failing if another device is mapped to any of them. Stack accesses,
+// call and rts still use Data for the range, as does instruction fetching.
+// StepBack does not rewind devices: their writes are not undone, and neither
+// are the ticks of a Ticker, so a timer keeps counting from where it was.
+// Devices must not be mapped while the processor is running.
+func (pr *ICMCProcessor) MapDevice(start, end uint16, d Device) error {
+	if end < start {
+		return fmt.Errorf("device end must not be before it's start")
+	}
+	if end >= 1<<15 {
+		return fmt.Errorf("device range %.5d..%.5d outside of data", start, end)
+	}
+
+	for _, m := range pr.devices {
+		if start <= m.End && end >= m.Start {
+			return fmt.Errorf("device range %.5d..%.5d overlaps %v", start, end, m)
+		}
+	}
+
+	pr.devices = append(pr.devices, DeviceMapping{start, end, d})
+	pr.updateTickers()
+	return nil
+}
+
+// UnmapDevice removes the device mapped starting at an address.
+func (pr *ICMCProcessor) UnmapDevice(start uint16) error {
+	for i, m := range pr.devices {
+		if m.Start == start {
+			pr.devices = append(pr.devices[:i:i], pr.devices[i+1:]...)
+			pr.updateTickers()
+			return nil
+		}
+	}
+	return fmt.Errorf("no device mapped at %.5d", start)
+}
+
+// Devices returns all devices mapped.
+func (pr *ICMCProcessor) Devices() []DeviceMapping {
+	return pr.devices
+}
+
+// findDevice returns the mapping with an address, if any.
+func (pr *ICMCProcessor) findDevice(addr uint16) *DeviceMapping {
+	for i := range pr.devices {
+		if addr >= pr.devices[i].Start && addr <= pr.devices[i].End {
+			return &pr.devices[i]
+		}
+	}
+	return nil
+}
+
+// load reads a word for a load instruction, from a device if one is mapped
+// to the address or from Data otherwise.
+func (pr *ICMCProcessor) load(addr uint16) (uint16, error) {
+	if len(pr.devices) == 0 {
+		return pr.readData(addr), nil
+	}
+
+	m := pr.findDevice(addr)
+	if m == nil {
+		return pr.readData(addr), nil
+	}
+
+	v, err := m.Device.Read(addr - m.Start)
+	if err != nil {
+		return 0, fmt.Errorf("device at %.5d: %v", addr, err)
+	}
+	if len(pr.watchpoints) != 0 {
+		pr.checkWatch(addr, WatchRead, v, v)
+	}
+	return v, nil
+}
+
+// store writes a word for a store instruction, to a device if one is mapped
+// to the address or to Data otherwise.
+func (pr *ICMCProcessor) store(addr, v uint16) error {
+	if len(pr.devices) == 0 {
+		pr.writeData(addr, v)
+		return nil
+	}
+
+	m := pr.findDevice(addr)
+	if m == nil {
+		pr.writeData(addr, v)
+		return nil
+	}
+
+	if len(pr.watchpoints) != 0 {
+		// devices can't be read without side effects, so the old value is
+		// not known
+		pr.checkWatch(addr, WatchWrite, v, v)
+	}
+	if err := m.Device.Write(addr-m.Start, v); err != nil {
+		return fmt.Errorf("device at %.5d: %v", addr, err)
+	}
+	return nil
+}
+
+// resetDevices resets every device mapped.
+func (pr *ICMCProcessor) resetDevices() {
+	for _, m := range pr.devices {
+		m.Device.Reset()
+	}
+}
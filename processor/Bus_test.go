@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testDevice is a device with 4 registers, where reading register 3 counts
+// the reads and writing it fails.
+type testDevice struct {
+	regs  [4]uint16
+	reads uint16
+}
+
+func (d *testDevice) Read(offset uint16) (uint16, error) {
+	if offset == 3 {
+		d.reads++
+		return d.reads, nil
+	}
+	return d.regs[offset], nil
+}
+
+func (d *testDevice) Write(offset, v uint16) error {
+	if offset == 3 {
+		return fmt.Errorf("read only register")
+	}
+	d.regs[offset] = v
+	return nil
+}
+
+func (d *testDevice) Reset() {
+	*d = testDevice{}
+}
+
+func TestBus(t *testing.T) {
+	var d *testDevice
+	mapDevice := func(pr *ICMCProcessor) {
+		d = &testDevice{}
+		if err := pr.MapDevice(1000, 1003, d); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	runPrograms(t, []testProgram{
+		{
+			name:  "store and load go to the device",
+			setup: mapDevice,
+			prog: prog(loadn(0, 42), withImm(OpSTORE, 0, 1001),
+				withImm(OpLOAD, 1<<7, 1001)),
+			regs: map[int]uint16{1: 42}, mem: map[uint16]uint16{1001: 0},
+		},
+		{
+			name:  "loadi reads the device every time",
+			setup: mapDevice,
+			prog: prog(loadn(0, 1003), rr(OpLOADI, 1, 0), rr(OpLOADI, 2, 0),
+				rr(OpLOADI, 3, 0)),
+			regs: map[int]uint16{1: 1, 2: 2, 3: 3},
+		},
+		{
+			name:  "addresses around the device use data",
+			setup: mapDevice,
+			prog: prog(loadn(0, 7), withImm(OpSTORE, 0, 999),
+				withImm(OpSTORE, 0, 1004), withImm(OpLOAD, 1<<7, 1000)),
+			regs: map[int]uint16{1: 0}, mem: map[uint16]uint16{999: 7, 1004: 7},
+		},
+		{
+			name:  "push and pop do not use the device",
+			setup: func(pr *ICMCProcessor) { mapDevice(pr); pr.SP = 1002 },
+			prog:  prog(loadn(0, 7), r(OpPUSH, 0, 0)),
+			mem:   map[uint16]uint16{1002: 7},
+		},
+		{
+			name:    "device errors stop execution",
+			setup:   mapDevice,
+			prog:    prog(loadn(0, 1003), rr(OpSTOREI, 0, 0)),
+			wantErr: "device at 01003: read only register",
+		},
+	})
+
+	pr, _ := newTestProcessor(nil, nil)
+	mapDevice(pr)
+	d.regs[0] = 5
+	pr.Reset()
+	if d.regs[0] != 0 {
+		t.Errorf("device not reset with the processor")
+	}
+}
+
+func TestMapDevice(t *testing.T) {
+	pr := NewEmptyProcessor(nil, nil)
+
+	if err := pr.MapDevice(100, 199, &testDevice{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		start, end uint16
+		ok         bool
+	}{
+		{200, 299, true},
+		{50, 99, true},
+		{150, 250, false},
+		{0, 100, false},
+		{199, 199, false},
+		{10, 5, false},
+		{0x7ff0, 0x8000, false},
+	}
+	for _, test := range tests {
+		err := pr.MapDevice(test.start, test.end, &testDevice{})
+		if (err == nil) != test.ok {
+			t.Errorf("MapDevice(%d, %d) = %v", test.start, test.end, err)
+		}
+	}
+	if len(pr.Devices()) != 3 {
+		t.Errorf("%d devices mapped, want 3", len(pr.Devices()))
+	}
+
+	if err := pr.UnmapDevice(100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pr.UnmapDevice(100); err == nil {
+		t.Errorf("device unmapped twice")
+	}
+	if err := pr.MapDevice(150, 199, &testDevice{}); err != nil {
+		t.Errorf("range of an unmapped device not reused: %v", err)
+	}
+}
+
+func TestBusWatchpoint(t *testing.T) {
+	pr, _ := newTestProcessor(prog(loadn(0, 9), withImm(OpSTORE, 0, 1000)), nil)
+	pr.MapDevice(1000, 1000, &testDevice{})
+	pr.AddWatchpoint(Watchpoint{1000, 1000, WatchWrite})
+
+	for i := 0; i < 2; i++ {
+		if err := pr.RunInstruction(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	hit, ok := pr.LastWatchHit()
+	if !ok || hit.Addr != 1000 || hit.New != 9 {
+		t.Errorf("watchpoint hit %v, %v on a device write", hit, ok)
+	}
+}
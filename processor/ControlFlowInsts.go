@@ -13,6 +13,9 @@ func genJMPM(inst uint16) string {
 	if subOpcode == 0 {
 		return "jmp"
 	}
+	if int(subOpcode) >= len(cFlowM) {
+		return "<invalid jump>"
+	}
 
 	return "j" + cFlowM[subOpcode]
 }
@@ -22,15 +25,16 @@ func genCALLM(inst uint16) string {
 	if subOpcode == 0 {
 		return "call"
 	}
+	if int(subOpcode) >= len(cFlowM) {
+		return "<invalid call>"
+	}
 	return "c" + cFlowM[subOpcode]
 }
 
 func execCMP(pr *ICMCProcessor) error {
-	inst := pr.Data[pr.PC]
-
 	// get register indicies
-	RS1 := getRegAt(inst, 7)
-	RS2 := getRegAt(inst, 4)
+	RS1 := pr.cur.rd
+	RS2 := pr.cur.rs1
 
 	// get the data at those registers
 	RS1data := pr.GPRRegs[RS1]
@@ -55,16 +59,14 @@ func execCMP(pr *ICMCProcessor) error {
 }
 
 func execRTS(pr *ICMCProcessor) error {
-	// if the stack is empty, we cannot return anywhere!
-	if pr.SP >= ((1 << 15) - 1) {
-		return fmt.Errorf("invalid stack pointer value")
+	// get the PC we (hopefully) stored before at a call, if the stack is
+	// empty, we cannot return anywhere!
+	ret, err := pr.pop()
+	if err != nil {
+		return err
 	}
 
-	// get the PC we (hopefully) stored before at a call
-	pr.PC = pr.Data[pr.SP+1] - 1
-
-	// and increment the stack pointer to return it to the original position
-	pr.SP++
+	pr.PC = ret - 1
 	return nil
 }
 
@@ -95,9 +97,9 @@ func shouldExecute(fr flagRegisterState, subOpcode uint16) (bool, error) {
 	case 10:
 		return fr&(lesser|equal) != 0, nil
 	case 11:
-		return fr&carry == carry, nil // overflow is an alias for carry
+		return fr&overflow == overflow, nil
 	case 12:
-		return fr&carry == 0, nil
+		return fr&overflow == 0, nil
 	case 13:
 		return fr&negative == negative, nil
 	case 14:
@@ -108,8 +110,8 @@ func shouldExecute(fr flagRegisterState, subOpcode uint16) (bool, error) {
 }
 
 func execJMP(pr *ICMCProcessor) error {
-	subOpcode := (pr.Data[pr.PC] >> 6) & 0b1111
-	should, err := shouldExecute(pr.fr, subOpcode)
+	subOpcode := uint16(pr.cur.sub)
+	should, err := shouldExecute(pr.visibleFR(), subOpcode)
 	if err != nil {
 		return err
 	}
@@ -123,13 +125,13 @@ func execJMP(pr *ICMCProcessor) error {
 
 	// actually jump: set the PC to our immediate argument... -2 because at the
 	// end of RunInstruction we still increment PC.
-	pr.PC = pr.Data[pr.PC+1] - 2
+	pr.PC = pr.cur.imm - 2
 	return nil
 }
 
 func execCALL(pr *ICMCProcessor) error {
-	subOpcode := (pr.Data[pr.PC] & (0b1111 << 6)) >> 6
-	should, err := shouldExecute(pr.fr, subOpcode)
+	subOpcode := uint16(pr.cur.sub)
+	should, err := shouldExecute(pr.visibleFR(), subOpcode)
 	if err != nil {
 		return err
 	}
@@ -141,18 +143,13 @@ func execCALL(pr *ICMCProcessor) error {
 		return fmt.Errorf("call at the end of data section")
 	}
 
-	if pr.SP >= (1<<15) || pr.SP == 0 {
-		return fmt.Errorf("invalid stack pointer value")
-	}
-
 	// the return address is the next instruction in relation to us
-	pr.Data[pr.SP] = pr.PC + 2
-
-	// decrement the stack pointer, aka finalize a push PC+2
-	pr.SP--
+	if err = pr.push(pr.PC + 2); err != nil {
+		return err
+	}
 
 	// actually call: set the PC to our immediate argument... -2 because at the
 	// end of RunInstruction we still increment PC.
-	pr.PC = pr.Data[pr.PC+1] - 2
+	pr.PC = pr.cur.imm - 2
 	return nil
 }
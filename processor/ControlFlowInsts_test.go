@@ -0,0 +1,121 @@
+package processor
+
+import "testing"
+
+func TestShouldExecute(t *testing.T) {
+	tests := []struct {
+		sub       uint16
+		taken     flagRegisterState
+		notTaken  flagRegisterState
+		mnemonic  string
+		condition string
+	}{
+		{1, equal, 0, "jeq", "equal"},
+		{2, 0, equal, "jne", "not equal"},
+		{3, zero, 0, "jz", "zero"},
+		{4, 0, zero, "jnz", "not zero"},
+		{5, carry, 0, "jc", "carry"},
+		{6, 0, carry, "jnc", "not carry"},
+		{7, greater, lesser, "jgr", "greater"},
+		{8, lesser, greater, "jle", "lesser"},
+		{9, equal, lesser, "jeg", "equal or greater"},
+		{10, lesser, greater, "jel", "equal or lesser"},
+		{11, overflow, 0, "jov", "overflow"},
+		{12, 0, overflow, "jnov", "not overflow"},
+		{13, negative, 0, "jn", "negative"},
+		{14, divZero, 0, "jdz", "division by zero"},
+	}
+
+	for _, tt := range tests {
+		if ok, err := shouldExecute(tt.taken, tt.sub); err != nil || !ok {
+			t.Errorf("%s: not taken with fr %07b, err %v", tt.condition, tt.taken, err)
+		}
+		if ok, err := shouldExecute(tt.notTaken, tt.sub); err != nil || ok {
+			t.Errorf("%s: taken with fr %07b, err %v", tt.condition, tt.notTaken, err)
+		}
+		if m := genJMPM(encode(OpJMP, tt.sub<<6)); m != tt.mnemonic {
+			t.Errorf("sub opcode %d disassembled as %s, want %s", tt.sub, m, tt.mnemonic)
+		}
+	}
+
+	if ok, err := shouldExecute(0, 0); err != nil || !ok {
+		t.Errorf("unconditional branch not taken, err %v", err)
+	}
+	if _, err := shouldExecute(0, 15); err == nil {
+		t.Errorf("sub opcode 15 should be invalid")
+	}
+}
+
+func TestControlFlow(t *testing.T) {
+	runPrograms(t, []testProgram{
+		{
+			name: "jmp skips code",
+			// 0: jmp 4; 2: loadn r0, 1; 4: loadn r1, 2
+			prog: prog(withImm(OpJMP, 0, 4), loadn(0, 1), loadn(1, 2)),
+			regs: map[int]uint16{0: 0, 1: 2},
+		},
+		{
+			name: "jeq taken",
+			// 0: cmp r0, r1; 1: jeq 5; 3: loadn r2, 1; 5: halt
+			prog: prog(rr(OpCMP, 0, 1), withImm(OpJMP, 1<<6, 5), loadn(2, 1)),
+			regs: map[int]uint16{2: 0},
+		},
+		{
+			name: "jne not taken",
+			prog: prog(rr(OpCMP, 0, 1), withImm(OpJMP, 2<<6, 5), loadn(2, 1)),
+			regs: map[int]uint16{2: 1},
+		},
+		{
+			name: "call and rts",
+			// 0: call 5; 2: loadn r1, 2; 4: halt... the subroutine is at 5
+			prog: append(prog(withImm(OpCALL, 0, 5), loadn(1, 2)),
+				append(loadn(0, 1), encode(OpRTS, 0))...),
+			regs: map[int]uint16{0: 1, 1: 2}, sp: u16((1 << 15) - 1),
+		},
+		{
+			name: "call pushes the return address",
+			// the subroutine is the halt at 2
+			prog: prog(withImm(OpCALL, 0, 2)),
+			sp:   u16((1 << 15) - 2),
+			mem:  map[uint16]uint16{(1 << 15) - 1: 2},
+		},
+		{
+			name: "conditional call not taken",
+			prog: prog(withImm(OpCALL, 3<<6, 10)),
+			sp:   u16((1 << 15) - 1),
+		},
+		{
+			name:    "rts with an empty stack",
+			prog:    prog([]uint16{encode(OpRTS, 0)}),
+			wantErr: "invalid stack pointer",
+		},
+		{
+			name:    "call with a full stack",
+			prog:    prog(withImm(OpCALL, 0, 2)),
+			setup:   func(pr *ICMCProcessor) { pr.SP = 0 },
+			wantErr: "invalid stack pointer",
+		},
+		{
+			name:     "cmp greater",
+			prog:     prog(loadn(0, 2), loadn(1, 1), rr(OpCMP, 0, 1)),
+			flagsSet: greater, flagsClear: lesser | equal,
+		},
+		{
+			name:     "cmp lesser",
+			prog:     prog(loadn(0, 1), loadn(1, 2), rr(OpCMP, 0, 1)),
+			flagsSet: lesser, flagsClear: greater | equal,
+		},
+		{
+			name:     "cmp equal",
+			prog:     prog(loadn(0, 2), loadn(1, 2), rr(OpCMP, 0, 1)),
+			flagsSet: equal, flagsClear: greater | lesser,
+		},
+		{
+			name: "loop counts to ten",
+			// 0: inc r0; 1: cmp r0, r1; 2: jne 0; 4: halt
+			prog: prog(loadn(1, 10), r(OpINCDEC, 0, 0), rr(OpCMP, 0, 1),
+				withImm(OpJMP, 2<<6, 2)),
+			regs: map[int]uint16{0: 10},
+		},
+	})
+}
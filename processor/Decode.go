@@ -0,0 +1,59 @@
+package processor
+
+// decodedInst is the predecoded form of an instruction word, with the fields
+// every instruction handler would otherwise extract on each execution.
+type decodedInst struct {
+	inst *Instruction // nil if the entry must be decoded again
+	word uint16       // the word decoded, to detect changes made to Data
+	imm  uint16       // the word after it, the immediate of two word instructions
+
+	rd, rs1, rs2 uint8 // the register fields at bits 7, 4 and 1
+	sub          uint8 // bits 6 to 9, the condition of jumps and calls
+}
+
+// addrMask wraps an address into Data, so that indexing with it needs no
+// bounds check.
+const addrMask = (1 << 15) - 1
+
+// decode returns the predecoded instruction at an address, decoding it only
+// if it is not in the cache or is stale. An entry is stale if the words it was
+// decoded from changed, which catches stores made by the program and writes
+// to Data made outside the processor (such as the memory editor or a snapshot
+// being loaded) alike, so self modifying code always runs what is in memory.
+// The opcode table must be up to date, see checkDecoded. It returns false if
+// the opcode does not exist.
+func (pr *ICMCProcessor) decode(addr uint16) (*decodedInst, bool) {
+	addr &= addrMask
+	d := &pr.decoded[addr]
+	word, imm := pr.Data[addr], pr.Data[(addr+1)&addrMask]
+	if d.inst != nil && d.word == word && d.imm == imm {
+		return d, true
+	}
+
+	inst, ok := findInstruction(word)
+	if !ok {
+		d.inst = nil
+		return nil, false
+	}
+
+	*d = decodedInst{
+		inst: inst,
+		word: word,
+		imm:  imm,
+		rd:   uint8(getRegAt(word, 7)),
+		rs1:  uint8(getRegAt(word, 4)),
+		rs2:  uint8(getRegAt(word, 1)),
+		sub:  uint8(word>>6) & 0b1111,
+	}
+	return d, true
+}
+
+// checkDecoded rebuilds the opcode table if needed, and discards the decoded
+// instructions if they point to an old table.
+func (pr *ICMCProcessor) checkDecoded() {
+	checkOpcodeTable()
+	if pr.decodedGen != tableGen {
+		pr.decoded = [1 << 15]decodedInst{}
+		pr.decodedGen = tableGen
+	}
+}
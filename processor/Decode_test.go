@@ -0,0 +1,75 @@
+package processor
+
+import "testing"
+
+func TestSelfModifyingCode(t *testing.T) {
+	decR0 := r(OpINCDEC, 0, 1<<6)[0]
+
+	runPrograms(t, []testProgram{
+		{
+			name: "store over an executed instruction",
+			// 0: loadn r1, 2; 2: inc r0; 3: loadn r2, dec r0; 5: store 2, r2
+			// 7: dec r1; 8: jnz 2
+			prog: prog(loadn(1, 2), r(OpINCDEC, 0, 0), loadn(2, decR0),
+				withImm(OpSTORE, 2<<7, 2), r(OpINCDEC, 1, 1<<6),
+				withImm(OpJMP, 4<<6, 2)),
+			regs: map[int]uint16{0: 0},
+			mem:  map[uint16]uint16{2: decR0},
+		},
+		{
+			name: "store over an executed immediate",
+			// 0: loadn r1, 2; 2: loadn r0, 5; 4: loadn r2, 9; 6: store 3, r2
+			// 8: dec r1; 9: jnz 2
+			prog: prog(loadn(1, 2), loadn(0, 5), loadn(2, 9),
+				withImm(OpSTORE, 2<<7, 3), r(OpINCDEC, 1, 1<<6),
+				withImm(OpJMP, 4<<6, 2)),
+			regs: map[int]uint16{0: 9},
+		},
+		{
+			name: "storei over an executed instruction",
+			// 0: loadn r1, 2; 2: loadn r3, 4; 4: inc r0; 5: loadn r2, dec r0
+			// 7: storei r3, r2; 8: dec r1; 9: jnz 4
+			prog: prog(loadn(1, 2), loadn(3, 4), r(OpINCDEC, 0, 0),
+				loadn(2, decR0), rr(OpSTOREI, 3, 2), r(OpINCDEC, 1, 1<<6),
+				withImm(OpJMP, 4<<6, 4)),
+			regs: map[int]uint16{0: 0},
+		},
+	})
+}
+
+func TestDecodeExternalWrites(t *testing.T) {
+	pr, _ := newTestProcessor(prog(loadn(0, 1)), nil)
+
+	run := func() {
+		t.Helper()
+		pr.PC = 0
+		if err := pr.RunInstruction(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	run()
+	if pr.GPRRegs[0] != 1 {
+		t.Fatalf("R0 = %d, want 1", pr.GPRRegs[0])
+	}
+
+	// writes made directly to Data, as the memory editor does, must be seen
+	pr.Data[1] = 7
+	run()
+	if pr.GPRRegs[0] != 7 {
+		t.Errorf("R0 = %d after changing the immediate, want 7", pr.GPRRegs[0])
+	}
+
+	pr.Data[0] = loadn(3, 0)[0]
+	run()
+	if pr.GPRRegs[3] != 7 {
+		t.Errorf("R3 = %d after changing the instruction, want 7", pr.GPRRegs[3])
+	}
+
+	// an invalid opcode written over a cached instruction is an error
+	pr.Data[0] = encode(0b111111, 0)
+	pr.PC = 0
+	if err := pr.RunInstruction(); err == nil {
+		t.Errorf("invalid opcode written over a cached instruction ran")
+	}
+}
@@ -0,0 +1,136 @@
+package processor_test
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasgpulcinelli/goICMCsim/assembler"
+	"github.com/lucasgpulcinelli/goICMCsim/headless"
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// goldenInput is the input given to every golden program's inchar.
+const goldenInput = "x"
+
+// dumpState describes the state of a runner after a program executes, in the
+// format of the golden files.
+func dumpState(r *headless.Runner) string {
+	pr := r.Proc
+
+	var b strings.Builder
+	for i, v := range pr.GPRRegs {
+		fmt.Fprintf(&b, "R%d = %d\n", i, v)
+	}
+	fmt.Fprintf(&b, "SP = %d\nPC = %d\n", pr.SP, pr.PC)
+	for _, f := range processor.AllFlags {
+		fmt.Fprintf(&b, "%s = %v\n", f, pr.GetFlag(f))
+	}
+	fmt.Fprintf(&b, "screen:\n%s\n", r.ScreenText())
+	return b.String()
+}
+
+// TestGolden runs every program in testdata and compares the final state with
+// the matching .golden file. Run with -update to regenerate them.
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.asm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			src, err := os.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer src.Close()
+
+			r := headless.NewRunner([]byte(goldenInput))
+			if err := r.LoadAsm(src); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Run(5 * time.Second); err != nil {
+				t.Fatal(err)
+			}
+
+			got := dumpState(r)
+			golden := strings.TrimSuffix(file, ".asm") + ".golden"
+
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("state differs from %s:\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+// TestMnemonicRoundTrip checks that the disassembly of every instruction
+// assembles back to the same words. For two word instructions, the operand
+// word is shown apart from the mnemonic and goes after (or, for store, before)
+// the register.
+func TestMnemonicRoundTrip(t *testing.T) {
+	pr := processor.NewEmptyProcessor(nil, nil)
+
+	for _, inst := range processor.AllInstructions {
+		if inst.Size == 0 {
+			continue
+		}
+
+		for bits := 0; bits < 1<<10; bits++ {
+			word := uint16(inst.Op)<<10 | uint16(bits)
+			pr.Data[0], pr.Data[1] = word, uint16(bits*37)
+			m := pr.GetMnemonic(0, 0)
+			if strings.HasPrefix(m, "<") {
+				continue // an invalid sub-opcode, such as of a jump
+			}
+
+			src := m
+			if inst.Size == 2 {
+				name, reg, hasReg := strings.Cut(m, " ")
+				op := pr.GetMnemonic(1, 0)
+				switch {
+				case inst.Op == processor.OpSTORE:
+					src = name + " " + op + ", " + reg
+				case hasReg:
+					src = m + ", " + op
+				default:
+					src = m + " " + op
+				}
+			}
+
+			words, err := assembler.Assemble(strings.NewReader(src))
+			if err != nil {
+				t.Errorf("%016b: %q does not assemble: %v", word, src, err)
+				continue
+			}
+			// the disassembly ignores unused bits, so compare the disassembly
+			// of the assembled words instead of the words themselves.
+			pr.Data[0], pr.Data[1] = words[0], words[1]
+			if again := pr.GetMnemonic(0, 0); again != m {
+				t.Errorf("%016b: %q assembled as %q", word, src, again)
+			}
+			if inst.Size == 2 && pr.Data[1] != uint16(bits*37) {
+				t.Errorf("%016b: %q assembled with operand %d", word, src,
+					pr.Data[1])
+			}
+		}
+	}
+}
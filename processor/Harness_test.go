@@ -0,0 +1,167 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// testProgram describes a small program and the state expected after running
+// it with RunUntilHalt.
+type testProgram struct {
+	name  string
+	prog  []uint16
+	input []byte                  // keys read by inchar, 255 after they end
+	setup func(pr *ICMCProcessor) // run after loading, before executing
+
+	regs       map[int]uint16    // expected register values
+	sp         *uint16           // expected stack pointer, if not nil
+	mem        map[uint16]uint16 // expected Data words
+	flagsSet   flagRegisterState // flags that must be set
+	flagsClear flagRegisterState // flags that must be clear
+	screen     map[uint16]uint16 // expected characters written by outchar
+	wantErr    string            // a substring of the error expected
+}
+
+// fakeIO implements the inchar and outchar hooks without any display.
+type fakeIO struct {
+	input  []byte
+	screen map[uint16]uint16
+}
+
+func (f *fakeIO) inChar() (uint8, error) {
+	if len(f.input) == 0 {
+		return 255, nil
+	}
+	c := f.input[0]
+	f.input = f.input[1:]
+	return c, nil
+}
+
+func (f *fakeIO) outChar(c, pos uint16) error {
+	f.screen[pos] = c
+	return nil
+}
+
+// newTestProcessor creates a processor with fake hooks and a program loaded.
+func newTestProcessor(prog []uint16, input []byte) (*ICMCProcessor, *fakeIO) {
+	io := &fakeIO{input: input, screen: map[uint16]uint16{}}
+	pr := NewEmptyProcessor(io.inChar, io.outChar)
+	copy(pr.Code[:], prog)
+	pr.Reset()
+	return pr, io
+}
+
+// runProgram runs a test program until a halt and checks the state after it.
+func runProgram(t *testing.T, tp testProgram) {
+	t.Helper()
+
+	pr, io := newTestProcessor(tp.prog, tp.input)
+	if tp.setup != nil {
+		tp.setup(pr)
+	}
+
+	// every program must halt quickly, a timeout avoids hanging the tests
+	timer := time.AfterFunc(5*time.Second, func() { pr.Stop() })
+	defer timer.Stop()
+
+	var period time.Duration
+	err := pr.RunUntilHalt(&period)
+
+	if tp.wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), tp.wantErr) {
+			t.Errorf("got error %v, want error containing %q", err, tp.wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("unexpected error at PC %d: %v", pr.PC, err)
+	}
+	if Opcode(pr.Data[pr.PC]>>10) != OpHALT {
+		t.Fatalf("program stopped at PC %d without a halt", pr.PC)
+	}
+
+	for r, v := range tp.regs {
+		if pr.GPRRegs[r] != v {
+			t.Errorf("R%d = %d, want %d", r, pr.GPRRegs[r], v)
+		}
+	}
+	if tp.sp != nil && pr.SP != *tp.sp {
+		t.Errorf("SP = %d, want %d", pr.SP, *tp.sp)
+	}
+	for addr, v := range tp.mem {
+		if pr.Data[addr] != v {
+			t.Errorf("Data[%d] = %d, want %d", addr, pr.Data[addr], v)
+		}
+	}
+	if pr.fr&tp.flagsSet != tp.flagsSet {
+		t.Errorf("FR = %07b, want bits %07b set", pr.fr, tp.flagsSet)
+	}
+	if pr.fr&tp.flagsClear != 0 {
+		t.Errorf("FR = %07b, want bits %07b clear", pr.fr, tp.flagsClear)
+	}
+	for pos, c := range tp.screen {
+		if io.screen[pos] != c {
+			t.Errorf("screen[%d] = %d, want %d", pos, io.screen[pos], c)
+		}
+	}
+}
+
+// runPrograms runs every test program as a subtest.
+func runPrograms(t *testing.T, tps []testProgram) {
+	for _, tp := range tps {
+		tp := tp
+		t.Run(tp.name, func(t *testing.T) { runProgram(t, tp) })
+	}
+}
+
+// the helpers below encode instructions, returning the words for each one so
+// that programs can be built with prog.
+
+// prog concatenates instructions into a program ending with a halt.
+func prog(insts ...[]uint16) []uint16 {
+	var ret []uint16
+	for _, inst := range insts {
+		ret = append(ret, inst...)
+	}
+	return append(ret, halt()...)
+}
+
+func encode(op Opcode, bits uint16) uint16 {
+	return uint16(op)<<10 | bits
+}
+
+func halt() []uint16 { return []uint16{encode(OpHALT, 0)} }
+
+func nop() []uint16 { return []uint16{encode(OpNOP, 0)} }
+
+func loadn(rd, v uint16) []uint16 {
+	return []uint16{encode(OpLOADN, rd<<7), v}
+}
+
+// rrr encodes an ALU-like instruction with three registers.
+func rrr(op Opcode, rd, rs1, rs2 uint16) []uint16 {
+	return []uint16{encode(op, rd<<7|rs1<<4|rs2<<1)}
+}
+
+// rr encodes an instruction with two registers, at bits 7 and 4.
+func rr(op Opcode, r1, r2 uint16) []uint16 {
+	return []uint16{encode(op, r1<<7|r2<<4)}
+}
+
+// r encodes an instruction with a single register at bit 7, plus extra bits.
+func r(op Opcode, r1, bits uint16) []uint16 {
+	return []uint16{encode(op, r1<<7|bits)}
+}
+
+// withImm encodes a two word instruction with extra bits and an immediate.
+func withImm(op Opcode, bits, imm uint16) []uint16 {
+	return []uint16{encode(op, bits), imm}
+}
+
+// carryBit sets the carry variant of an ALU instruction.
+func carryBit(inst []uint16) []uint16 {
+	return []uint16{inst[0] | 1}
+}
+
+func u16(v uint16) *uint16 { return &v }
@@ -35,14 +35,19 @@ const (
 	OpHALT           = 0b001111
 	OpBREAKP         = 0b001110
 	OpCSCARRY        = 0b001000
+	OpEIDI           = 0b001001
+	OpRETI           = 0b001010
+	OpSETIV          = 0b001011
 )
 
 // Instruction describes all data a single instruction needs to be fully
-// described for execution and display.
+// described for execution and display. Outside of this package, instructions
+// should be written with keyed fields, as more fields may be added.
 type Instruction struct {
 	Op          Opcode
 	GenMnemonic func(uint16) string
 	Size        byte
+	Cycles      byte // the clock cycles the instruction takes in the hardware
 	Execute     func(*ICMCProcessor) error
 }
 
@@ -51,52 +56,56 @@ type Instruction struct {
 // and create the two function hooks.
 // The ALU instructions are complicated because they use functional programming
 // and reuse some ALU properties, such as flag register settings.
-// The order here is important! The most executed instructions must appear
-// first for faster instruction fetching
+// Instructions are fetched through an opcode table built from this list, so
+// the order here does not matter for performance.
+//
+// The cycles follow the states of the VHDL processor: every instruction takes
+// a fetch and a decode cycle, plus one execute cycle for ALU-like results and
+// for each extra memory access (the immediate of two word instructions, the
+// data of load and store, and the stack).
 var AllInstructions = []Instruction{
-	{OpJMP, genJMPM, 2, execJMP},
-	{OpINCDEC, genINCDECM, 1, execINCDEC},
-	{OpINCHAR, genRegM("inchar", 1), 1, execINCHAR},
-	{OpCMP, genRegM("cmp", 2), 1, execCMP},
-	{OpADD, genALUM(true, "add"), 1,
+	{OpJMP, genJMPM, 2, 3, execJMP},
+	{OpINCDEC, genINCDECM, 1, 3, execINCDEC},
+	{OpINCHAR, genRegM("inchar", 1), 1, 3, execINCHAR},
+	{OpCMP, genRegM("cmp", 2), 1, 3, execCMP},
+	{OpADD, genALUM(true, "add"), 1, 3,
 		execALU(true, func(a, b uint32) uint32 { return a + b }),
 	},
-	{OpSUB, genALUM(true, "sub"), 1,
+	{OpSUB, genALUM(true, "sub"), 1, 3,
 		execALU(true, func(a, b uint32) uint32 { return a - b }),
 	},
-	{OpMULT, genALUM(true, "mult"), 1,
-		execALU(true, func(a, b uint32) uint32 { return a * b }),
-	},
-	{OpMOD, genALUM(false, "mod"), 1,
-		execALU(false, func(a, b uint32) uint32 { return a % b }),
-	},
-	{OpCALL, genCALLM, 2, execCALL},
-	{OpOUTCHAR, genRegM("outchar", 2), 1, execOUTCHAR},
-	{OpAND, genALUM(false, "and"), 1,
+	{OpMULT, genALUM(true, "mult"), 1, 3, execMULT},
+	{OpMOD, genALUM(false, "mod"), 1, 3, execMOD},
+	{OpCALL, genCALLM, 2, 4, execCALL},
+	{OpOUTCHAR, genRegM("outchar", 2), 1, 3, execOUTCHAR},
+	{OpAND, genALUM(false, "and"), 1, 3,
 		execALU(false, func(a, b uint32) uint32 { return a & b }),
 	},
-	{OpOR, genALUM(false, "or"), 1,
+	{OpOR, genALUM(false, "or"), 1, 3,
 		execALU(false, func(a, b uint32) uint32 { return a | b }),
 	},
-	{OpXOR, genALUM(false, "xor"), 1,
+	{OpXOR, genALUM(false, "xor"), 1, 3,
 		execALU(false, func(a, b uint32) uint32 { return a ^ b }),
 	},
-	{OpDIV, genALUM(true, "div"), 1, execDIV},
-	{OpNOT, genRegM("not", 2), 1, execNOT},
-	{OpLOADI, genRegM("loadi", 2), 1, execLOADI},
-	{OpSTOREI, genRegM("storei", 2), 1, execSTOREI},
-	{OpPUSH, genRegM("push", 1), 1, execPUSH},
-	{OpPOP, genRegM("pop", 1), 1, execPOP},
-	{OpLOADN, genRegM("loadn", 1), 2, execLOADN},
-	{OpLOAD, genRegM("load", 1), 2, execLOAD},
-	{OpSTORE, genRegM("store", 1), 2, execSTORE},
-	{OpRTS, genRegM("rts", 0), 1, execRTS},
-	{OpNOP, genRegM("nop", 0), 1, execNOP},
-	{OpHALT, genRegM("halt", 0), 0, execSTOP},
-	{OpBREAKP, genRegM("breakp", 0), 1, execSTOP},
-	{OpCSCARRY, genCSCARRYM, 1, execCSCARRY},
-	{OpROTSH, genROTSHM, 1, execROTSH},
-	{OpMOV, genMOVM, 1, execMOV},
+	{OpDIV, genALUM(true, "div"), 1, 3, execDIV},
+	{OpNOT, genRegM("not", 2), 1, 3, execNOT},
+	{OpLOADI, genRegM("loadi", 2), 1, 3, execLOADI},
+	{OpSTOREI, genRegM("storei", 2), 1, 3, execSTOREI},
+	{OpPUSH, genRegM("push", 1), 1, 3, execPUSH},
+	{OpPOP, genRegM("pop", 1), 1, 3, execPOP},
+	{OpLOADN, genRegM("loadn", 1), 2, 3, execLOADN},
+	{OpLOAD, genRegM("load", 1), 2, 4, execLOAD},
+	{OpSTORE, genRegM("store", 1), 2, 4, execSTORE},
+	{OpRTS, genRegM("rts", 0), 1, 4, execRTS},
+	{OpNOP, genRegM("nop", 0), 1, 2, execNOP},
+	{OpHALT, genRegM("halt", 0), 0, 2, execSTOP},
+	{OpBREAKP, genRegM("breakp", 0), 1, 2, execSTOP},
+	{OpCSCARRY, genCSCARRYM, 1, 2, execCSCARRY},
+	{OpEIDI, genEIDIM, 1, 2, execEIDI},
+	{OpRETI, genRegM("reti", 0), 1, 4, execRETI},
+	{OpSETIV, genRegM("setiv", 1), 1, 3, execSETIV},
+	{OpROTSH, genROTSHM, 1, 3, execROTSH},
+	{OpMOV, genMOVM, 1, 3, execMOV},
 }
 
 // toRegStr gets the name of a register based on it's index.
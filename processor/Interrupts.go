@@ -0,0 +1,111 @@
+package processor
+
+// Ticker is a Device that keeps track of time, such as a timer. Tick is called
+// after every instruction with the clock cycles it took, and an interrupt is
+// raised when it returns true. Ticks are not undone by StepBack.
+type Ticker interface {
+	Device
+	Tick(cycles uint64) bool
+}
+
+// interruptInst is run instead of the instruction at PC to take an interrupt.
+// It has no size, so the PC it saves is the one of the instruction that was
+// not run, and takes the cycles of a call.
+var interruptInst = Instruction{OpNOP, genRegM("int", 0), 0, 4, execInterrupt}
+
+// interruptDecoded is the decoded form of interruptInst, without any operands.
+var interruptDecoded = decodedInst{inst: &interruptInst}
+
+// InterruptsEnabled returns if interrupts are taken, as set by ei and di.
+func (pr *ICMCProcessor) InterruptsEnabled() bool {
+	return pr.intEnabled
+}
+
+// SetInterruptsEnabled enables or disables interrupts, as ei and di do.
+func (pr *ICMCProcessor) SetInterruptsEnabled(v bool) {
+	pr.intEnabled = v
+}
+
+// InterruptPending returns if an interrupt was raised and not taken yet,
+// because interrupts are disabled or it was raised by the last instruction.
+func (pr *ICMCProcessor) InterruptPending() bool {
+	return pr.intPending
+}
+
+// SetInterruptPending raises an interrupt, to be taken before the next
+// instruction if interrupts are enabled, or discards the pending one.
+func (pr *ICMCProcessor) SetInterruptPending(v bool) {
+	pr.intPending = v
+}
+
+// updateTickers finds the devices mapped that are tickers.
+func (pr *ICMCProcessor) updateTickers() {
+	pr.tickers = nil
+	for _, m := range pr.devices {
+		if t, ok := m.Device.(Ticker); ok {
+			pr.tickers = append(pr.tickers, t)
+		}
+	}
+}
+
+// tick tells every ticker an instruction ran, raising an interrupt if any of
+// them asks for it.
+func (pr *ICMCProcessor) tick(cycles uint64) {
+	for _, t := range pr.tickers {
+		if t.Tick(cycles) {
+			pr.intPending = true
+		}
+	}
+}
+
+// execInterrupt pushes the PC and the flag register (in the layout of push
+// fr), disables interrupts and jumps to the interrupt vector.
+func execInterrupt(pr *ICMCProcessor) error {
+	if err := pr.push(pr.PC); err != nil {
+		return err
+	}
+	if err := pr.push(pr.encodeFR()); err != nil {
+		return err
+	}
+
+	pr.intEnabled, pr.intPending = false, false
+	pr.PC = pr.IntVector
+	return nil
+}
+
+func genEIDIM(inst uint16) string {
+	if inst&(1<<9) != 0 {
+		return "ei"
+	}
+	return "di"
+}
+
+func execEIDI(pr *ICMCProcessor) error {
+	pr.intEnabled = pr.cur.word&(1<<9) != 0
+	return nil
+}
+
+// execRETI returns from an interrupt, restoring the flag register and the PC
+// saved when it was taken and enabling interrupts again.
+func execRETI(pr *ICMCProcessor) error {
+	fr, err := pr.pop()
+	if err != nil {
+		return err
+	}
+	ret, err := pr.pop()
+	if err != nil {
+		return err
+	}
+
+	pr.decodeFR(fr)
+	pr.intEnabled = true
+
+	// -1 because at the end of RunInstruction we still increment PC
+	pr.PC = ret - 1
+	return nil
+}
+
+func execSETIV(pr *ICMCProcessor) error {
+	pr.IntVector = pr.GPRRegs[pr.cur.rd]
+	return nil
+}
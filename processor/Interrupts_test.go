@@ -0,0 +1,151 @@
+package processor
+
+import "testing"
+
+// testTicker is a device without registers raising an interrupt after a number
+// of instructions.
+type testTicker struct {
+	at, n int
+}
+
+func (t *testTicker) Read(offset uint16) (uint16, error) { return 0, nil }
+func (t *testTicker) Write(offset, v uint16) error       { return nil }
+func (t *testTicker) Reset()                             { t.n = 0 }
+
+func (t *testTicker) Tick(cycles uint64) bool {
+	t.n++
+	return t.n == t.at
+}
+
+// withHandler returns a program with an interrupt handler at address 20.
+func withHandler(main []uint16, handler ...[]uint16) []uint16 {
+	p := make([]uint16, 20)
+	copy(p, main)
+	for _, inst := range handler {
+		p = append(p, inst...)
+	}
+	return p
+}
+
+func TestInterrupts(t *testing.T) {
+	const top = (1 << 15) - 1
+	setc := []uint16{encode(OpCSCARRY, 1<<9)}
+	clearc := []uint16{encode(OpCSCARRY, 0)}
+	ei, di := []uint16{encode(OpEIDI, 1<<9)}, []uint16{encode(OpEIDI, 0)}
+	reti := []uint16{encode(OpRETI, 0)}
+	incs := prog(r(OpINCDEC, 1, 0), r(OpINCDEC, 1, 0), r(OpINCDEC, 1, 0))
+	loads := prog(loadn(1, 1), loadn(1, 2), loadn(1, 3)) // flags are kept
+
+	ticker := func(at int) func(pr *ICMCProcessor) {
+		return func(pr *ICMCProcessor) {
+			pr.MapDevice(1000, 1000, &testTicker{at: at})
+		}
+	}
+
+	runPrograms(t, []testProgram{
+		{
+			name:  "interrupt runs the handler and returns",
+			setup: ticker(5),
+			// 0: loadn r0, 20; 2: setiv r0; 3: setc; 4: ei; 5: loadn r1 (x3)
+			prog: withHandler(prog(loadn(0, 20), r(OpSETIV, 0, 0), setc, ei, loads),
+				loadn(2, 7), clearc, reti),
+			regs: map[int]uint16{1: 3, 2: 7}, sp: u16(top), flagsSet: carry,
+		},
+		{
+			name:  "handler saves pc and flags",
+			setup: ticker(5),
+			prog: withHandler(prog(loadn(0, 20), r(OpSETIV, 0, 0), setc, ei, loads),
+				halt()),
+			regs: map[int]uint16{1: 1}, sp: u16(top - 2),
+			mem: map[uint16]uint16{top: 7, top - 1: uint16(carry)},
+		},
+		{
+			name:  "disabled interrupts stay pending",
+			setup: ticker(3),
+			prog: withHandler(prog(loadn(0, 20), r(OpSETIV, 0, 0), r(OpINCDEC, 1, 0),
+				di, r(OpINCDEC, 1, 0), ei, r(OpINCDEC, 1, 0)),
+				loadn(2, 7), reti),
+			regs: map[int]uint16{1: 3, 2: 7}, sp: u16(top),
+		},
+		{
+			name:  "interrupts start disabled",
+			setup: ticker(1),
+			prog:  withHandler(incs, loadn(2, 7), reti),
+			regs:  map[int]uint16{1: 3, 2: 0},
+		},
+		{
+			name:    "reti with an empty stack",
+			prog:    prog(reti),
+			wantErr: "invalid stack pointer",
+		},
+	})
+}
+
+func TestInterruptStepBack(t *testing.T) {
+	pr, _ := newTestProcessor(prog(loadn(0, 20), r(OpSETIV, 0, 0),
+		[]uint16{encode(OpEIDI, 1<<9)}, nop()), nil)
+	pr.SetJournalSize(10)
+
+	for i := 0; i < 3; i++ {
+		if err := pr.RunInstruction(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	pr.SetInterruptPending(true)
+	if err := pr.RunInstruction(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pr.PC != 20 || pr.InterruptsEnabled() || pr.InterruptPending() {
+		t.Fatalf("interrupt not taken, PC %d", pr.PC)
+	}
+
+	if err := pr.StepBack(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pr.PC != 4 || !pr.InterruptsEnabled() || !pr.InterruptPending() {
+		t.Errorf("interrupt not undone, PC %d", pr.PC)
+	}
+	if pr.SP != (1<<15)-1 || pr.Data[(1<<15)-1] != 0 || pr.Data[(1<<15)-2] != 0 {
+		t.Errorf("stack writes of the interrupt not undone")
+	}
+
+	for i := 0; i < 3; i++ {
+		pr.StepBack()
+	}
+	if pr.IntVector != 0 || pr.InterruptsEnabled() {
+		t.Errorf("setiv and ei not undone")
+	}
+}
+
+func TestInterruptTrace(t *testing.T) {
+	const top = (1 << 15) - 1
+	pr, _ := newTestProcessor(prog(loadn(0, 20), r(OpSETIV, 0, 0),
+		[]uint16{encode(OpEIDI, 1<<9)}, nop()), nil)
+	var tr recordTracer
+	pr.SetTracer(&tr)
+
+	for i := 0; i < 3; i++ {
+		if err := pr.RunInstruction(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	pr.SetInterruptPending(true)
+	if err := pr.RunInstruction(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the record has the PC saved and not the nop that was not run, and
+	// both words pushed
+	rec := tr[len(tr)-1]
+	if rec.Kind != TraceInterrupt || rec.Mnemonic() != "int" || rec.PC != 4 ||
+		rec.Inst != 0 || rec.Size != 0 {
+		t.Errorf("interrupt traced as %+v", rec)
+	}
+	want := TraceRecord{MemWrites: 2, MemAddr: [2]uint16{top, top - 1},
+		MemValue: [2]uint16{4, pr.Data[top-1]}}
+	if rec.MemWrites != want.MemWrites || rec.MemAddr != want.MemAddr ||
+		rec.MemValue != want.MemValue {
+		t.Errorf("interrupt wrote %d words at %v with %v, want %v with %v",
+			rec.MemWrites, rec.MemAddr, rec.MemValue, want.MemAddr, want.MemValue)
+	}
+}
@@ -0,0 +1,186 @@
+package processor
+
+import "fmt"
+
+// blankChar is the value of a screen position never written by outchar: a
+// '\0' with the background color, the same the display starts with.
+const blankChar = 16 << 8
+
+// journalEntry stores the state needed to undo a single instruction. Every
+// ICMC instruction writes at most one Data word and one screen position, and
+// taking an interrupt writes two words, so entries have a fixed size and
+// recording them does not allocate.
+type journalEntry struct {
+	regs      [8]uint16
+	sp        uint16
+	pc        uint16
+	fr        flagRegisterState
+	instCount uint64
+	cycles    uint64
+
+	intEnabled bool   // if interrupts were enabled
+	intPending bool   // if an interrupt was pending
+	intVector  uint16 // the interrupt vector
+
+	memWrites int       // how many Data words the instruction wrote
+	memAddr   [2]uint16 // the addresses written
+	memOld    [2]uint16 // the values before the writes
+
+	outWritten bool   // if the instruction wrote to the screen
+	outPos     uint16 // the screen position written
+	outOld     uint16 // the character before the write
+}
+
+// journal is a bounded ring buffer of journal entries, discarding the oldest
+// ones when full.
+type journal struct {
+	entries []journalEntry
+	start   int
+	n       int
+}
+
+// push adds a new entry, returning it to be filled.
+func (j *journal) push() *journalEntry {
+	var i int
+	if j.n == len(j.entries) {
+		i = j.start
+		j.start = (j.start + 1) % len(j.entries)
+	} else {
+		i = (j.start + j.n) % len(j.entries)
+		j.n++
+	}
+
+	j.entries[i] = journalEntry{}
+	return &j.entries[i]
+}
+
+// pop removes the newest entry, returning it.
+func (j *journal) pop() (*journalEntry, bool) {
+	if j.n == 0 {
+		return nil, false
+	}
+	j.n--
+	return &j.entries[(j.start+j.n)%len(j.entries)], true
+}
+
+// SetJournalSize sets how many instructions can be undone with StepBack. A
+// size of zero (the default) disables the journal. The current journal is
+// discarded.
+func (pr *ICMCProcessor) SetJournalSize(n int) {
+	pr.journal = journal{entries: make([]journalEntry, n)}
+	pr.curEntry = nil
+}
+
+// JournalLen returns how many instructions can currently be undone.
+func (pr *ICMCProcessor) JournalLen() int {
+	return pr.journal.n
+}
+
+// record starts the journal entry for the instruction about to run.
+func (pr *ICMCProcessor) record() {
+	if len(pr.journal.entries) == 0 {
+		return
+	}
+
+	e := pr.journal.push()
+	e.regs = pr.GPRRegs
+	e.sp = pr.SP
+	e.pc = pr.PC
+	e.fr = pr.fr
+	e.instCount = pr.InstCount
+	e.cycles = pr.CycleCount
+	e.intEnabled = pr.intEnabled
+	e.intPending = pr.intPending
+	e.intVector = pr.IntVector
+	pr.curEntry = e
+}
+
+// recordWrite stores the old value of a Data word in the current entry.
+func (pr *ICMCProcessor) recordWrite(addr uint16) {
+	if pr.curEntry == nil {
+		return
+	}
+	e := pr.curEntry
+	if e.memWrites == len(e.memAddr) {
+		// no instruction writes more words, this only keeps a bug from
+		// becoming a crash
+		return
+	}
+	e.memAddr[e.memWrites] = addr
+	e.memOld[e.memWrites] = pr.Data[addr]
+	e.memWrites++
+}
+
+// recordOutChar stores the old character at a screen position in the
+// current entry, and keeps track of the new one.
+func (pr *ICMCProcessor) recordOutChar(char, pos uint16) {
+	old, ok := pr.screen[pos]
+	if !ok {
+		old = blankChar
+	}
+	pr.screen[pos] = char
+
+	if pr.curEntry == nil {
+		return
+	}
+	pr.curEntry.outWritten = true
+	pr.curEntry.outPos = pos
+	pr.curEntry.outOld = old
+}
+
+// SetScreenChar sets the character known to be at a screen position without
+// calling the outchar hook, for screens drawn before the last Reset, such as
+// one restored from a snapshot. StepBack draws it again when undoing a later
+// outchar to that position.
+func (pr *ICMCProcessor) SetScreenChar(pos, char uint16) {
+	if char == blankChar {
+		delete(pr.screen, pos)
+		return
+	}
+	pr.screen[pos] = char
+}
+
+// StepBack undoes the last instruction run, restoring registers, the flag
+// register, the Data word and the screen position it wrote.
+func (pr *ICMCProcessor) StepBack() error {
+	e, ok := pr.journal.pop()
+	if !ok {
+		return fmt.Errorf("no instruction to step back to")
+	}
+	pr.curEntry = nil
+
+	pr.GPRRegs = e.regs
+	pr.SP = e.sp
+	pr.PC = e.pc
+	pr.fr = e.fr
+	pr.InstCount = e.instCount
+	pr.CycleCount = e.cycles
+	pr.intEnabled = e.intEnabled
+	pr.intPending = e.intPending
+	pr.IntVector = e.intVector
+
+	// in reverse order, in case the same word was written twice
+	for i := e.memWrites - 1; i >= 0; i-- {
+		pr.Data[e.memAddr[i]] = e.memOld[i]
+	}
+	if e.outWritten {
+		pr.screen[e.outPos] = e.outOld
+		return pr.outChar(e.outOld, e.outPos)
+	}
+	return nil
+}
+
+// RunBackUntilBreakpoint steps back at least one instruction, and then
+// continues until the PC is at a breakpoint or the journal is empty.
+func (pr *ICMCProcessor) RunBackUntilBreakpoint() error {
+	if err := pr.StepBack(); err != nil {
+		return err
+	}
+
+	for pr.journal.n > 0 && !pr.HasBreakpoint(pr.PC) {
+		if err := pr.StepBack(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
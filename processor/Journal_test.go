@@ -0,0 +1,95 @@
+package processor
+
+import "testing"
+
+// runN runs n instructions, failing the test on errors.
+func runN(t *testing.T, pr *ICMCProcessor, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		if err := pr.RunInstruction(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+// stepBack steps back one instruction, failing the test on errors.
+func stepBack(t *testing.T, pr *ICMCProcessor) {
+	t.Helper()
+
+	if err := pr.StepBack(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestStepBackStore(t *testing.T) {
+	pr, _ := newTestProcessor(prog(loadn(1, 9), withImm(OpSTORE, 1<<7, 100)), nil)
+	pr.SetJournalSize(10)
+	pr.Data[100] = 7
+
+	runN(t, pr, 2)
+	stepBack(t, pr)
+	if pr.Data[100] != 7 || pr.GPRRegs[1] != 9 || pr.PC != 2 ||
+		pr.InstCount != 1 {
+		t.Errorf("store stepped back to Data[100] = %d, r1 = %d, PC = %d",
+			pr.Data[100], pr.GPRRegs[1], pr.PC)
+	}
+}
+
+func TestStepBackOutChar(t *testing.T) {
+	pr, io := newTestProcessor(prog(loadn(0, 'A'), loadn(1, 5),
+		rr(OpOUTCHAR, 0, 1), loadn(0, 'B'), rr(OpOUTCHAR, 0, 1)), nil)
+	pr.SetJournalSize(10)
+
+	runN(t, pr, 5)
+	if io.screen[5] != 'B' {
+		t.Fatalf("outchar drew %d, want %d", io.screen[5], 'B')
+	}
+
+	// the hook draws the character before each outchar again
+	stepBack(t, pr)
+	if io.screen[5] != 'A' {
+		t.Errorf("step back drew %d, want %d", io.screen[5], 'A')
+	}
+	stepBack(t, pr)
+	stepBack(t, pr)
+	if io.screen[5] != blankChar {
+		t.Errorf("step back drew %d, want a blank", io.screen[5])
+	}
+}
+
+func TestJournalWraparound(t *testing.T) {
+	pr, _ := newTestProcessor(prog(nop(), nop(), nop(), nop(), nop()), nil)
+	pr.SetJournalSize(3)
+
+	runN(t, pr, 5)
+	if pr.JournalLen() != 3 {
+		t.Fatalf("journal has %d entries, want 3", pr.JournalLen())
+	}
+
+	// only the newest entries are kept
+	for i := 0; i < 3; i++ {
+		stepBack(t, pr)
+	}
+	if pr.PC != 2 || pr.InstCount != 2 {
+		t.Errorf("stepped back to PC %d after %d instructions, want 2 and 2",
+			pr.PC, pr.InstCount)
+	}
+	if err := pr.StepBack(); err == nil {
+		t.Errorf("stepped back past the oldest entry")
+	}
+}
+
+func TestStepBackEmpty(t *testing.T) {
+	pr, _ := newTestProcessor(prog(nop()), nil)
+	if err := pr.StepBack(); err == nil {
+		t.Errorf("stepped back without a journal")
+	}
+
+	// a journal only has the instructions run after it is set
+	runN(t, pr, 1)
+	pr.SetJournalSize(10)
+	if err := pr.StepBack(); err == nil || pr.PC != 1 {
+		t.Errorf("stepped back with an empty journal")
+	}
+}
@@ -2,125 +2,137 @@ package processor
 
 import "fmt"
 
+// push writes a word to the top of the stack, decrementing the stack pointer.
+// With BoundsWrap the stack wraps around Data instead of failing.
+func (pr *ICMCProcessor) push(v uint16) error {
+	if pr.profile.Bounds == BoundsError && (pr.SP >= (1<<15) || pr.SP == 0) {
+		return fmt.Errorf("invalid stack pointer value")
+	}
+
+	pr.writeData(pr.SP&addrMask, v)
+	pr.SP--
+	return nil
+}
+
+// pop reads the word at the top of the stack, incrementing the stack pointer.
+func (pr *ICMCProcessor) pop() (uint16, error) {
+	if pr.profile.Bounds == BoundsError && pr.SP >= (1<<15)-1 {
+		return 0, fmt.Errorf("invalid stack pointer value")
+	}
+
+	pr.SP++
+	return pr.readData(pr.SP & addrMask), nil
+}
+
 func execPUSH(pr *ICMCProcessor) error {
 	var value uint16
 
-	inst := pr.Data[pr.PC]
+	inst := pr.cur.word
 
 	// see if we are pushing the flag register
 	if inst&(1<<6) != 0 {
-		// because a sequence of push fr, pop rX is considered seriously bad
-		// practice, the meaning in the sequence of bits in the flag register do
-		// not match the original implementation.
-		value = uint16(pr.fr)
+		// the meaning of each bit depends on the profile, as the native one
+		// does not match the original implementation.
+		value = pr.encodeFR()
 	} else {
-		RS := getRegAt(inst, 7)
+		RS := pr.cur.rd
 		value = pr.GPRRegs[RS]
 	}
 
-	if pr.SP >= (1<<15) || pr.SP == 0 {
-		return fmt.Errorf("invalid stack pointer value")
-	}
-
-	pr.Data[pr.SP] = value
-	pr.SP--
-	return nil
+	return pr.push(value)
 }
 
 func execPOP(pr *ICMCProcessor) error {
-	inst := pr.Data[pr.PC]
+	inst := pr.cur.word
 
-	if pr.SP >= (1 << 15) {
-		return fmt.Errorf("invalid stack pointer value")
+	value, err := pr.pop()
+	if err != nil {
+		return err
 	}
 
-	pr.SP++
-
 	// see if we are popping the flag register
 	if inst&(1<<6) != 0 {
-		pr.fr = flagRegisterState(pr.Data[pr.SP])
+		pr.decodeFR(value)
 	} else {
-		RD := getRegAt(inst, 7)
-		pr.GPRRegs[RD] = pr.Data[pr.SP]
+		RD := pr.cur.rd
+		pr.GPRRegs[RD] = value
 	}
 	return nil
 }
 
 func execLOADN(pr *ICMCProcessor) error {
-	inst := pr.Data[pr.PC]
-
-	RD := getRegAt(inst, 7)
+	RD := pr.cur.rd
 
 	if pr.PC == (1<<15)-1 {
 		return fmt.Errorf("loadn at the end of data section")
 	}
 
-	pr.GPRRegs[RD] = pr.Data[pr.PC+1]
+	pr.GPRRegs[RD] = pr.cur.imm
 	return nil
 }
 
 func execLOAD(pr *ICMCProcessor) error {
-	inst := pr.Data[pr.PC]
-
-	RD := getRegAt(inst, 7)
+	RD := pr.cur.rd
 
 	if pr.PC >= (1<<15)-1 {
 		return fmt.Errorf("load at the end of data section")
 	}
 
-	loc := pr.Data[pr.PC+1]
-	if loc >= (1<<15)-1 {
-		return fmt.Errorf("load has invalid memory as operand")
+	loc, err := pr.checkAddress(pr.cur.imm, "load")
+	if err != nil {
+		return err
 	}
 
-	pr.GPRRegs[RD] = pr.Data[loc]
+	v, err := pr.load(loc)
+	if err != nil {
+		return err
+	}
+
+	pr.GPRRegs[RD] = v
 	return nil
 }
 
 func execSTORE(pr *ICMCProcessor) error {
-	inst := pr.Data[pr.PC]
-
-	RS := getRegAt(inst, 7)
+	RS := pr.cur.rd
 
 	if pr.PC == (1<<15)-1 {
 		return fmt.Errorf("store at the end of data section")
 	}
 
-	loc := pr.Data[pr.PC+1]
-	if loc >= (1<<15)-1 {
-		return fmt.Errorf("store has invalid memory as operand")
+	loc, err := pr.checkAddress(pr.cur.imm, "store")
+	if err != nil {
+		return err
 	}
 
-	pr.Data[loc] = pr.GPRRegs[RS]
-	return nil
+	return pr.store(loc, pr.GPRRegs[RS])
 }
 
 func execLOADI(pr *ICMCProcessor) error {
-	inst := pr.Data[pr.PC]
+	RD := pr.cur.rd
+	RS := pr.cur.rs1
 
-	RD := getRegAt(inst, 7)
-	RS := getRegAt(inst, 4)
+	loc, err := pr.checkAddress(pr.GPRRegs[RS], "loadi")
+	if err != nil {
+		return err
+	}
 
-	loc := pr.GPRRegs[RS]
-	if loc >= (1<<15)-1 {
-		return fmt.Errorf("loadi has invalid memory as operand")
+	v, err := pr.load(loc)
+	if err != nil {
+		return err
 	}
 
-	pr.GPRRegs[RD] = pr.Data[loc]
+	pr.GPRRegs[RD] = v
 	return nil
 }
 
 func execSTOREI(pr *ICMCProcessor) error {
-	inst := pr.Data[pr.PC]
-
-	RD := getRegAt(inst, 7)
-	RS := getRegAt(inst, 4)
+	RD := pr.cur.rd
+	RS := pr.cur.rs1
 
-	loc := pr.GPRRegs[RD]
-	if loc >= (1<<15)-1 {
-		return fmt.Errorf("storei has invalid memory as operand")
+	loc, err := pr.checkAddress(pr.GPRRegs[RD], "storei")
+	if err != nil {
+		return err
 	}
 
-	pr.Data[loc] = pr.GPRRegs[RS]
-	return nil
+	return pr.store(loc, pr.GPRRegs[RS])
 }
@@ -0,0 +1,78 @@
+package processor
+
+import "testing"
+
+func TestMemory(t *testing.T) {
+	const top = (1 << 15) - 1
+
+	runPrograms(t, []testProgram{
+		{
+			name: "loadn",
+			prog: prog(loadn(7, 0xbeef)),
+			regs: map[int]uint16{7: 0xbeef},
+		},
+		{
+			name: "store and load",
+			prog: prog(loadn(0, 42), withImm(OpSTORE, 0, 1000),
+				withImm(OpLOAD, 1<<7, 1000)),
+			regs: map[int]uint16{1: 42}, mem: map[uint16]uint16{1000: 42},
+		},
+		{
+			name: "storei and loadi",
+			prog: prog(loadn(0, 2000), loadn(1, 7), rr(OpSTOREI, 0, 1),
+				rr(OpLOADI, 2, 0)),
+			regs: map[int]uint16{2: 7}, mem: map[uint16]uint16{2000: 7},
+		},
+		{
+			name: "push and pop",
+			prog: prog(loadn(0, 5), loadn(1, 6), r(OpPUSH, 0, 0), r(OpPUSH, 1, 0),
+				r(OpPOP, 2, 0), r(OpPOP, 3, 0)),
+			regs: map[int]uint16{2: 6, 3: 5}, sp: u16(top),
+			mem: map[uint16]uint16{top: 5, top - 1: 6},
+		},
+		{
+			name: "push decrements sp",
+			prog: prog(r(OpPUSH, 0, 0)),
+			sp:   u16(top - 1),
+		},
+		{
+			name: "push and pop fr",
+			prog: prog(rr(OpCMP, 0, 1), []uint16{encode(OpCSCARRY, 1<<9)},
+				r(OpPUSH, 0, 1<<6), []uint16{encode(OpCSCARRY, 0)}, loadn(1, 1),
+				rr(OpCMP, 0, 1), r(OpPOP, 0, 1<<6)),
+			flagsSet: carry | equal, flagsClear: lesser,
+		},
+		{
+			name:    "load from an invalid address",
+			prog:    prog(withImm(OpLOAD, 0, top)),
+			wantErr: "invalid memory",
+		},
+		{
+			name:    "store to an invalid address",
+			prog:    prog(withImm(OpSTORE, 0, top)),
+			wantErr: "invalid memory",
+		},
+		{
+			name:    "loadi from an invalid address",
+			prog:    prog(loadn(1, 0xffff), rr(OpLOADI, 0, 1)),
+			wantErr: "invalid memory",
+		},
+		{
+			name:    "storei to an invalid address",
+			prog:    prog(loadn(0, 0xffff), rr(OpSTOREI, 0, 1)),
+			wantErr: "invalid memory",
+		},
+		{
+			name:    "push with a full stack",
+			prog:    prog(r(OpPUSH, 0, 0)),
+			setup:   func(pr *ICMCProcessor) { pr.SP = 0 },
+			wantErr: "invalid stack pointer",
+		},
+		{
+			name:    "pop with an invalid stack pointer",
+			prog:    prog(r(OpPOP, 0, 0)),
+			setup:   func(pr *ICMCProcessor) { pr.SP = 1 << 15 },
+			wantErr: "invalid stack pointer",
+		},
+	})
+}
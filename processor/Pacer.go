@@ -0,0 +1,144 @@
+package processor
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// batchTime is how long a batch of cycles should take, the pacer checks
+	// the time once per batch.
+	batchTime = 2 * time.Millisecond
+
+	// maxBatch is the batch size with no period, large enough for time checks
+	// not to slow execution down.
+	maxBatch = 1 << 18
+
+	// spinTime is how long before the deadline the pacer stops sleeping and
+	// spins instead, as sleeps may wake up a bit late.
+	spinTime = 50 * time.Microsecond
+
+	// maxLag is how far behind the requested clock the pacer may fall before
+	// it gives up catching up, so that a long pause (such as the machine being
+	// busy) does not make it run at full speed for a while afterwards.
+	maxLag = 100 * time.Millisecond
+
+	// statsWindow is how often the achieved frequency is measured.
+	statsWindow = 100 * time.Millisecond
+)
+
+// ClockStats tells how close RunUntilHalt is to the requested clock, in clock
+// cycles per second.
+type ClockStats struct {
+	Requested float64 // the frequency requested, zero if unlimited
+	Achieved  float64 // the frequency measured in the last 100ms
+}
+
+// clockStats holds the last ClockStats, written by the pacer while running
+// and read by anyone, so the values are atomic.
+type clockStats struct {
+	requested atomic.Uint64
+	achieved  atomic.Uint64
+}
+
+// ClockStats returns the clock requested and achieved by the current (or
+// last) RunUntilHalt.
+func (pr *ICMCProcessor) ClockStats() ClockStats {
+	return ClockStats{
+		Requested: math.Float64frombits(pr.clock.requested.Load()),
+		Achieved:  math.Float64frombits(pr.clock.achieved.Load()),
+	}
+}
+
+// pacer throttles execution to a period between clock cycles. Instead of
+// waiting after each instruction, instructions run in batches of cycles, and
+// after each batch the pacer waits until the time all cycles run until now
+// should have taken. Sleeping or running late in one batch is then
+// compensated in the next ones, keeping the average clock accurate.
+type pacer struct {
+	period *time.Duration // the period requested, may change while running
+	stats  *clockStats
+
+	// the clock used, replaced in tests so that they don't depend on the
+	// speed of the machine running them
+	now   func() time.Duration // the time since pacing started
+	sleep func(time.Duration)
+
+	due   time.Duration // when the cycles run until now should end
+	batch uint64        // the size of the current batch, in cycles
+	run   uint64        // cycles run in the current batch
+
+	winStart  time.Duration // when the current stats window started
+	winCycles uint64        // cycles run in the current stats window
+}
+
+func newPacer(period *time.Duration, stats *clockStats) *pacer {
+	start := time.Now()
+	return &pacer{
+		period: period, stats: stats,
+		now:   func() time.Duration { return time.Since(start) },
+		sleep: time.Sleep,
+		batch: batchSize(*period),
+	}
+}
+
+// batchSize returns how many cycles with a period run in batchTime.
+func batchSize(period time.Duration) uint64 {
+	if period <= 0 {
+		return maxBatch
+	}
+
+	n := uint64(batchTime / period)
+	if n < 1 {
+		return 1
+	} else if n > maxBatch {
+		return maxBatch
+	}
+	return n
+}
+
+// step must be called after each instruction with the cycles it took, and
+// waits at the end of a batch.
+func (p *pacer) step(cycles uint64) {
+	p.run += cycles
+	if p.run >= p.batch {
+		p.pace()
+	}
+}
+
+// pace ends a batch, waiting until the batch is due and starting the next.
+func (p *pacer) pace() {
+	period := *p.period
+	p.due += time.Duration(p.run) * period
+	p.winCycles += p.run
+
+	now := p.now()
+	if wait := p.due - now; wait > 0 {
+		// sleep for most of the wait, without using a CPU core, and spin only
+		// for the end of it
+		if wait > spinTime {
+			p.sleep(wait - spinTime)
+		}
+		for now < p.due {
+			now = p.now()
+		}
+	} else if -wait > maxLag {
+		p.due = now
+	}
+
+	if now-p.winStart >= statsWindow {
+		requested := 0.0
+		if period > 0 {
+			requested = float64(time.Second) / float64(period)
+		}
+		achieved := float64(p.winCycles) / (now - p.winStart).Seconds()
+
+		p.stats.requested.Store(math.Float64bits(requested))
+		p.stats.achieved.Store(math.Float64bits(achieved))
+		p.winStart, p.winCycles = now, 0
+	}
+
+	p.batch = batchSize(period)
+	p.run = 0
+}
@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBatchSize(t *testing.T) {
+	tests := []struct {
+		period time.Duration
+		want   uint64
+	}{
+		{0, maxBatch},
+		{time.Nanosecond, maxBatch},
+		{time.Microsecond, 2000},
+		{batchTime, 1},
+		{10 * time.Millisecond, 1},
+	}
+
+	for _, test := range tests {
+		if got := batchSize(test.period); got != test.want {
+			t.Errorf("batchSize(%v) = %d, want %d", test.period, got, test.want)
+		}
+	}
+}
+
+// fakeClock is a clock for the pacer that only moves when it sleeps, or by
+// a microsecond each time it is read, as when spinning.
+type fakeClock struct {
+	t      time.Duration
+	sleeps int
+}
+
+func (c *fakeClock) now() time.Duration {
+	c.t += time.Microsecond
+	return c.t
+}
+
+func (c *fakeClock) sleep(d time.Duration) {
+	c.t += d
+	c.sleeps++
+}
+
+// newFakePacer creates a pacer with a fake clock.
+func newFakePacer(period time.Duration) (*pacer, *fakeClock) {
+	c := &fakeClock{}
+	p := newPacer(&period, &clockStats{})
+	p.now, p.sleep = c.now, c.sleep
+	return p, c
+}
+
+func TestPacing(t *testing.T) {
+	period := 500 * time.Microsecond
+	p, c := newFakePacer(period)
+
+	// 1000 instructions of 3 cycles, with batches of 4 cycles that end every
+	// 2 instructions
+	for i := 0; i < 1000; i++ {
+		p.step(3)
+	}
+
+	// the last batch started is not waited for, and the spinning may run
+	// late by a read of the clock
+	want := time.Duration(3000-p.run) * period
+	if c.t < want || c.t > want+time.Microsecond {
+		t.Errorf("%d cycles took %v, want %v", 3000-p.run, c.t, want)
+	}
+	if c.sleeps != 500 {
+		t.Errorf("slept %d times, want once per batch (500)", c.sleeps)
+	}
+
+	stats := ClockStats{
+		Requested: math.Float64frombits(p.stats.requested.Load()),
+		Achieved:  math.Float64frombits(p.stats.achieved.Load()),
+	}
+	if stats.Requested != 2000 {
+		t.Errorf("requested clock = %v, want 2000", stats.Requested)
+	}
+	if math.Abs(stats.Achieved-2000) > 1 {
+		t.Errorf("achieved clock = %v, want 2000", stats.Achieved)
+	}
+}
+
+func TestPacingLag(t *testing.T) {
+	// a batch for every cycle
+	period := batchTime
+	p, c := newFakePacer(period)
+
+	// a pause longer than maxLag is not caught up on, so the next batch
+	// still waits for it's period
+	p.step(1)
+	c.t += time.Second
+	p.step(1)
+	before := c.t
+	p.step(1)
+	if c.t-before < period-spinTime {
+		t.Errorf("batch after a pause took %v, want %v", c.t-before, period)
+	}
+
+	// a shorter one is, without waiting
+	c.t += maxLag / 2
+	before = c.t
+	p.step(1)
+	if c.t-before > time.Microsecond {
+		t.Errorf("batch after a short pause waited %v", c.t-before)
+	}
+}
@@ -3,6 +3,7 @@ package processor
 import (
 	"fmt"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,13 +14,57 @@ type flagRegisterState int16
 const (
 	equal = 1 << iota
 	zero
-	carry // overflow is an alias for carry
+	carry
 	greater
 	lesser
 	negative
 	divZero
+	overflow // unless the profile separates them, an alias for carry
 )
 
+// Flag identifies a single bit of the flag register.
+type Flag flagRegisterState
+
+// the flag register bits, for use outside of the processor
+const (
+	FlagEqual    Flag = equal
+	FlagZero     Flag = zero
+	FlagCarry    Flag = carry
+	FlagGreater  Flag = greater
+	FlagLesser   Flag = lesser
+	FlagNegative Flag = negative
+	FlagDivZero  Flag = divZero
+	FlagOverflow Flag = overflow
+)
+
+// AllFlags lists every flag register bit, from the least significant.
+var AllFlags = []Flag{
+	FlagEqual, FlagZero, FlagCarry, FlagGreater, FlagLesser, FlagNegative,
+	FlagDivZero, FlagOverflow,
+}
+
+func (f Flag) String() string {
+	switch f {
+	case FlagEqual:
+		return "equal"
+	case FlagZero:
+		return "zero"
+	case FlagCarry:
+		return "carry"
+	case FlagGreater:
+		return "greater"
+	case FlagLesser:
+		return "lesser"
+	case FlagNegative:
+		return "negative"
+	case FlagDivZero:
+		return "divZero"
+	case FlagOverflow:
+		return "overflow"
+	}
+	return fmt.Sprintf("(unknown flag %d)", int(f))
+}
+
 // ICMCProcessor defines a complete simulated processor, with 1 << 15 (32768)
 // 16 bit words for data and code.
 // The processor is mostly the same as it's VHDL counterpart, except for the
@@ -32,13 +77,47 @@ type ICMCProcessor struct {
 	SP      uint16          // stack pointer
 	PC      uint16          // program counter
 
-	InstCount uint64 // the number of instructions since the processor started running
+	InstCount  uint64 // the number of instructions since the processor started running
+	CycleCount uint64 // the number of clock cycles those instructions took
 
 	fr flagRegisterState // the flag register, internal because of it's non portability
 
+	profile Profile // the behaviour of the parts of the ISA not fully specified
+
 	IsRunning bool
+	run       atomic.Int32                 // the state of the run, so that Stop works from any goroutine
 	inChar    func() (uint8, error)        // inchar environment hook
 	outChar   func(char, pos uint16) error // outchar environment hook
+
+	// the addresses RunUntilHalt stops at. An array is used instead of a map
+	// because breakpoints can be toggled while the processor is running.
+	breakpoints [1 << 15]bool
+
+	watchpoints []Watchpoint // memory ranges that stop RunUntilHalt on access
+	watchHit    *WatchHit    // the watchpoint triggered by the last instruction
+
+	devices []DeviceMapping // the devices load and store instructions access
+	tickers []Ticker        // the devices that are told about every instruction
+
+	IntVector  uint16 // the address interrupts jump to
+	intEnabled bool   // if interrupts are taken, set by ei and reti
+	intPending bool   // if an interrupt was raised and not taken yet
+
+	clock clockStats // the clock of the last RunUntilHalt
+
+	decoded    [1 << 15]decodedInst // the predecoded form of each Data word
+	decodedGen uint32               // the tableGen decoded was filled with
+	cur        *decodedInst         // the instruction being executed
+
+	tracer     Tracer      // receives a record of every instruction run, if not nil
+	traceRec   TraceRecord // the record of the instruction running, reused
+	wrote      int         // the Data words written by the running instruction
+	wroteAt    [2]uint16   // the addresses written, for the trace
+	wroteValue [2]uint16   // the values written, for the trace
+
+	journal  journal           // the undo history used by StepBack
+	curEntry *journalEntry     // the journal entry of the running instruction
+	screen   map[uint16]uint16 // characters written by outchar since Reset
 }
 
 func NewEmptyProcessor(inChar func() (uint8, error),
@@ -48,85 +127,168 @@ func NewEmptyProcessor(inChar func() (uint8, error),
 		SP:      (1 << 15) - 1,
 		inChar:  inChar,
 		outChar: outChar,
+		screen:  map[uint16]uint16{},
+		profile: Profiles[0],
+	}
+}
+
+// opcodeTable indexes AllInstructions by opcode, so that fetching is done in
+// constant time. Opcodes without an instruction are nil.
+var opcodeTable [64]*Instruction
+
+// tableSource is the AllInstructions the opcodeTable was built from.
+var tableSource []Instruction
+
+// tableGen counts how many times the opcode table was built, so that decoded
+// instructions pointing to an old table can be detected.
+var tableGen uint32
+
+// RebuildOpcodeTable builds the opcode table from AllInstructions and the
+// instructions registered with a sub-opcode. It is done automatically when
+// AllInstructions is replaced or appended to, but must be called after
+// changing the opcode of an instruction already in the list.
+// If two instructions have the same opcode, the first one is used.
+func RebuildOpcodeTable() {
+	opcodeTable = [64]*Instruction{}
+	for i := range AllInstructions {
+		op := AllInstructions[i].Op
+		if op < 64 && opcodeTable[op] == nil {
+			opcodeTable[op] = &AllInstructions[i]
+		}
+	}
+
+	subTable = [64][]*subInstruction{}
+	for i := range subInstructions {
+		op := subInstructions[i].inst.Op
+		subTable[op] = append(subTable[op], &subInstructions[i])
 	}
+
+	tableSource = AllInstructions
+	tableGen++
 }
 
-// fetchInstruction gets, based on an opcode and the AllInstructions list, the
-// instruction associated with the opocde.
+// checkOpcodeTable rebuilds the opcode table if AllInstructions is in another
+// array than the one it was built from. The table points to elements of the
+// list, so changes to them in place are seen without a rebuild.
+func checkOpcodeTable() {
+	if len(tableSource) != len(AllInstructions) ||
+		(len(AllInstructions) != 0 && &tableSource[0] != &AllInstructions[0]) {
+		RebuildOpcodeTable()
+	}
+}
+
+// fetchInstruction gets, based on an instruction word and the registered
+// instructions, the instruction that runs it.
 // It returns false if the opcode does not exist.
-//
-// For now, fetchInstruction executes a linear search in the list. This is
-// efficient in most cases because the most used instructions are at the
-// start of the list.
-//
-// TODO: maybe a binary search and some kind of instruction index switching
-// mechanism would be much faster.
-func fetchInstruction(op Opcode) (Instruction, bool) {
-	for _, inst := range AllInstructions {
-		if inst.Op == op {
-			return inst, true
+func fetchInstruction(word uint16) (*Instruction, bool) {
+	checkOpcodeTable()
+	return findInstruction(word)
+}
+
+// findInstruction implements fetchInstruction, without checking if the opcode
+// table must be rebuilt. Instructions registered with a sub-opcode matching
+// the word are preferred over the one in AllInstructions.
+func findInstruction(word uint16) (*Instruction, bool) {
+	op := word >> 10
+	for _, sub := range subTable[op] {
+		if word&sub.mask == sub.value {
+			return &sub.inst, true
 		}
 	}
-	return Instruction{}, false
+
+	inst := opcodeTable[op]
+	return inst, inst != nil
 }
 
 // RunInstruction runs a single instruction, incrementing the program counter.
 func (pr *ICMCProcessor) RunInstruction() error {
+	pr.checkDecoded()
+	return pr.runInstruction()
+}
+
+// runInstruction implements RunInstruction, without checking if the opcode
+// table must be rebuilt.
+func (pr *ICMCProcessor) runInstruction() error {
 	if pr.PC >= ((1 << 15) - 1) {
 		return fmt.Errorf("PC at the end of data section")
 	}
 
-	currentOpcode := Opcode(pr.Data[pr.PC] >> 10)
+	pr.watchHit = nil
+	pr.wrote = 0
+	pr.record()
 
-	inst, ok := fetchInstruction(currentOpcode)
+	// taking an interrupt is run as an instruction of it's own, so that it
+	// is traced, journaled and paced as any other
+	dec, ok := &interruptDecoded, true
+	if !pr.intPending || !pr.intEnabled {
+		dec, ok = pr.decode(pr.PC)
+	}
 	if !ok {
 		pr.PC++ // skip this instruction in order not to loop on the same error
 		return fmt.Errorf("instruction does not exist")
 	}
+	pr.cur = dec
+	inst := dec.inst
+
+	if pr.tracer != nil {
+		pr.startTrace(inst)
+	}
 
 	err := inst.Execute(pr)
 
+	if pr.tracer != nil {
+		if terr := pr.endTrace(); terr != nil && err == nil {
+			err = terr
+		}
+	}
+
 	pr.PC += uint16(inst.Size)
 	pr.InstCount++
-	return err
-}
+	pr.CycleCount += uint64(inst.Cycles)
 
-// busySleep loops the correct amount of time from a start time until 1000
-// instruction execution period. This is done in a separate function to ease
-// profiling
-func busySleep(instPeriod *time.Duration, start time.Time) {
-	for 1000*(*instPeriod)-time.Since(start) > 0 {
+	if len(pr.tickers) != 0 {
+		pr.tick(uint64(inst.Cycles))
 	}
+	return err
 }
 
 // RunUntilHalt runs every instruction until a halt is found or an error occurs
-// with a certain average period between instructions. The period is a pointer
-// to allow for dynamic modification.
+// with a certain average period between clock cycles, so that instructions
+// take as long as their Cycles. The period is a pointer to allow for dynamic
+// modification, and the clock achieved is reported by ClockStats.
 // If an error happens the program counter is still incremented, but if a halt
 // is read it will stop right before the increment.
+//
+// Execution also stops right before running an instruction at an address with
+// a breakpoint, except for the first one, so that a run can resume from a
+// breakpoint, and right after an instruction that triggered a watchpoint.
 func (pr *ICMCProcessor) RunUntilHalt(instPeriod *time.Duration) (err error) {
 	pr.IsRunning = true
+	pr.run.Store(runActive)
 
-	start := time.Now()
+	pace := newPacer(instPeriod, &pr.clock)
 
-	for {
-		err = pr.RunInstruction()
-		if err != nil || !pr.IsRunning {
+	// AllInstructions is not expected to change while running
+	pr.checkDecoded()
+
+	for first := true; ; first = false {
+		if !first && pr.breakpoints[pr.PC&((1<<15)-1)] {
 			break
 		}
 
-		// run the busy sleep only once every 1000 instructions, because time.Now()
-		// and time.Since() in a loop are expensive operations in our
-		// context, so it would affect execution time substatially when the clock
-		// frequency was high.
-		if pr.InstCount%1000 == 0 {
-			busySleep(instPeriod, start)
-
-			start = time.Now()
+		err = pr.runInstruction()
+		if err != nil || !pr.IsRunning || pr.watchHit != nil {
+			break
 		}
+		if pr.run.Load() == runStopping {
+			break
+		}
+
+		pace.step(uint64(pr.cur.inst.Cycles))
 	}
 
 	pr.IsRunning = false
+	pr.run.Store(runIdle)
 
 	if err != nil && err.Error() == "stop" {
 		err = nil
@@ -135,8 +297,51 @@ func (pr *ICMCProcessor) RunUntilHalt(instPeriod *time.Duration) (err error) {
 	return
 }
 
+// WriteMemory writes a Data word outside of any instruction, as when a user
+// edits memory. The edit goes through the journal, so that StepBack undoes
+// it, is checked against watchpoints and is traced with Kind TraceEdit. It
+// must not be called while the processor is running.
+func (pr *ICMCProcessor) WriteMemory(addr, v uint16) error {
+	if int(addr) >= len(pr.Data) {
+		return fmt.Errorf("address %d out of memory", addr)
+	}
+
+	pr.watchHit = nil
+	pr.wrote = 0
+	pr.record()
+	if pr.tracer != nil {
+		pr.traceRec = TraceRecord{Kind: TraceEdit, PC: pr.PC, OldFR: uint16(pr.fr)}
+	}
+
+	pr.writeData(addr, v)
+
+	// later writes from outside of instructions must not be journaled here
+	pr.curEntry = nil
+
+	if pr.tracer != nil {
+		return pr.endTrace()
+	}
+	return nil
+}
+
+// the states of RunUntilHalt, as seen by Stop.
+const (
+	runIdle     = iota // not running
+	runActive          // running
+	runStopping        // running, and stopping after the current instruction
+)
+
+// Stop makes RunUntilHalt return after the instruction it is running. Unlike
+// setting IsRunning, it can be called from any goroutine. It only stops the
+// run going on, returning false if there is none, so later runs are not
+// affected.
+func (pr *ICMCProcessor) Stop() bool {
+	return pr.run.CompareAndSwap(runActive, runStopping)
+}
+
 // Reset returns all registers to their initial state, and cleans the data
-// used, returning it to the initial Code provided.
+// used, returning it to the initial Code provided. The StepBack journal is
+// discarded.
 // Nothing related to screen cleaning is done.
 func (pr *ICMCProcessor) Reset() {
 	pr.SP = (1 << 15) - 1
@@ -146,10 +351,65 @@ func (pr *ICMCProcessor) Reset() {
 	}
 
 	pr.fr = flagRegisterState(0)
+	pr.IntVector = 0
+	pr.intEnabled, pr.intPending = false, false
+
+	pr.journal.start, pr.journal.n = 0, 0
+	pr.curEntry = nil
+	pr.screen = map[uint16]uint16{}
+	pr.resetDevices()
 
 	copy(pr.Data[:], pr.Code[:])
 }
 
+// GetFR returns the whole flag register, with the bits defined by AllFlags.
+func (pr *ICMCProcessor) GetFR() uint16 {
+	return uint16(pr.fr)
+}
+
+// SetFR replaces the whole flag register.
+func (pr *ICMCProcessor) SetFR(v uint16) {
+	pr.fr = flagRegisterState(v)
+}
+
+// GetFlag returns if a single flag register bit is set. If the profile has no
+// separate overflow flag, FlagOverflow is the carry.
+func (pr *ICMCProcessor) GetFlag(f Flag) bool {
+	return pr.visibleFR()&flagRegisterState(f) != 0
+}
+
+// SetFlag sets or clears a single flag register bit. If the profile has no
+// separate overflow flag, FlagOverflow changes the carry.
+func (pr *ICMCProcessor) SetFlag(f Flag, v bool) {
+	if f == FlagOverflow && !pr.profile.SeparateOverflow {
+		f = FlagCarry
+	}
+	if v {
+		pr.fr |= flagRegisterState(f)
+	} else {
+		pr.fr &= ^flagRegisterState(f)
+	}
+}
+
+// ToggleBreakpoint sets a breakpoint at an address if it had none, or
+// removes it otherwise. Breakpoints are kept after a Reset.
+func (pr *ICMCProcessor) ToggleBreakpoint(addr uint16) {
+	addr &= (1 << 15) - 1
+	pr.breakpoints[addr] = !pr.breakpoints[addr]
+}
+
+// HasBreakpoint returns if there is a breakpoint at an address.
+func (pr *ICMCProcessor) HasBreakpoint(addr uint16) bool {
+	return pr.breakpoints[addr&((1<<15)-1)]
+}
+
+// ClearBreakpoints removes every breakpoint.
+func (pr *ICMCProcessor) ClearBreakpoints() {
+	for i := range pr.breakpoints {
+		pr.breakpoints[i] = false
+	}
+}
+
 // GetMnemonic gets the assembly string that describes the data at a certain
 // location. If the data at that location is right before is a 32 bit
 // instructon, or if the opcode is invalid, the return value is the decimal
@@ -166,7 +426,7 @@ func (pr *ICMCProcessor) GetMnemonic(loc int, view int) string {
 	if pr.isOperand(loc) {
 		return fmt.Sprintf("#%d", instData)
 	} else {
-		inst, ok := fetchInstruction(Opcode(instData >> 10))
+		inst, ok := fetchInstruction(instData)
 		if !ok {
 			return fmt.Sprintf("<invalid opcode %d>", instData>>10)
 		}
@@ -185,7 +445,7 @@ func (pr *ICMCProcessor) isOperand(loc int) bool {
 	}
 
 	instPrevData := pr.Data[loc-1]
-	instPrev, ok := fetchInstruction(Opcode(instPrevData >> 10))
+	instPrev, ok := fetchInstruction(instPrevData)
 	if !ok {
 		// if the instruction before does not exist, it is certainly not 32 bits
 		return false
@@ -0,0 +1,195 @@
+package processor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOpcodeTable(t *testing.T) {
+	for _, inst := range AllInstructions {
+		got, ok := fetchInstruction(uint16(inst.Op) << 10)
+		if !ok || got.Op != inst.Op {
+			t.Errorf("opcode %06b not fetched", inst.Op)
+		}
+	}
+	if _, ok := fetchInstruction(0b111111 << 10); ok {
+		t.Errorf("invalid opcode fetched")
+	}
+
+	// appending to the list must rebuild the table
+	old := AllInstructions
+	defer func() { AllInstructions = old }()
+
+	AllInstructions = append(append([]Instruction{}, old...),
+		Instruction{0b111111, genRegM("test", 0), 1, 2, execNOP})
+	if inst, ok := fetchInstruction(0b111111 << 10); !ok || inst.GenMnemonic(0) != "test " {
+		t.Errorf("instruction appended to the list not fetched")
+	}
+
+	// and changing an opcode in place needs an explicit rebuild
+	AllInstructions[len(AllInstructions)-1].Op = 0b111110
+	RebuildOpcodeTable()
+	if _, ok := fetchInstruction(0b111111 << 10); ok {
+		t.Errorf("old opcode still fetched after a rebuild")
+	}
+	if _, ok := fetchInstruction(0b111110 << 10); !ok {
+		t.Errorf("new opcode not fetched after a rebuild")
+	}
+}
+
+func TestCycleCount(t *testing.T) {
+	// loadn (3) + store (4) + call (4) + rts (4) + halt (2), the subroutine
+	// being the rts at 7
+	pr, _ := newTestProcessor(append(prog(loadn(0, 1), withImm(OpSTORE, 0, 100),
+		withImm(OpCALL, 0, 7)), encode(OpRTS, 0)), nil)
+	pr.SetJournalSize(10)
+
+	var period time.Duration
+	if err := pr.RunUntilHalt(&period); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pr.InstCount != 5 || pr.CycleCount != 17 {
+		t.Errorf("ran %d instructions in %d cycles, want 5 in 17", pr.InstCount,
+			pr.CycleCount)
+	}
+
+	// stepping back undoes the halt and the rts
+	for i := 0; i < 2; i++ {
+		if err := pr.StepBack(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if pr.InstCount != 3 || pr.CycleCount != 11 {
+		t.Errorf("stepped back to %d instructions in %d cycles, want 3 in 11",
+			pr.InstCount, pr.CycleCount)
+	}
+}
+
+// recordTracer keeps every record traced.
+type recordTracer []TraceRecord
+
+func (t *recordTracer) Trace(r *TraceRecord) error {
+	*t = append(*t, *r)
+	return nil
+}
+
+func TestWriteMemory(t *testing.T) {
+	pr, _ := newTestProcessor(prog(loadn(0, 1)), nil)
+	pr.SetJournalSize(10)
+	var tr recordTracer
+	pr.SetTracer(&tr)
+	pr.AddWatchpoint(Watchpoint{100, 100, WatchWrite})
+
+	if err := pr.RunInstruction(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pr.WriteMemory(100, 7); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if hit, ok := pr.LastWatchHit(); !ok || hit.Addr != 100 || hit.New != 7 {
+		t.Errorf("edit triggered watchpoint %v, %v", hit, ok)
+	}
+	if len(tr) != 2 {
+		t.Fatalf("%d records traced, want 2", len(tr))
+	}
+	edit := tr[1]
+	if edit.Kind != TraceEdit || edit.Mnemonic() != "edit" || edit.MemWrites != 1 ||
+		edit.MemAddr[0] != 100 || edit.MemValue[0] != 7 || edit.Regs[0] != 1 {
+		t.Errorf("edit traced as %+v", edit)
+	}
+
+	// the edit is undone on it's own, and then the instruction
+	if err := pr.StepBack(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pr.Data[100] != 0 || pr.GPRRegs[0] != 1 {
+		t.Errorf("step back left Data[100] = %d and r0 = %d, want 0 and 1",
+			pr.Data[100], pr.GPRRegs[0])
+	}
+	if err := pr.StepBack(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pr.GPRRegs[0] != 0 || pr.PC != 0 {
+		t.Errorf("instruction not stepped back after the edit")
+	}
+}
+
+func TestStop(t *testing.T) {
+	// a stop with nothing running is lost, and the next run reaches the halt
+	pr, _ := newTestProcessor(prog(nop(), nop()), nil)
+	if pr.Stop() {
+		t.Errorf("stop without a run reported as done")
+	}
+	var period time.Duration
+	if err := pr.RunUntilHalt(&period); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pr.PC != 2 {
+		t.Errorf("run stopped at %d, want the halt at 2", pr.PC)
+	}
+
+	// an endless loop is stopped from another goroutine
+	pr, _ = newTestProcessor(withImm(OpJMP, 0, 0), nil)
+	done := make(chan error)
+	go func() { done <- pr.RunUntilHalt(&period) }()
+	for !pr.Stop() {
+		time.Sleep(time.Millisecond)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pr.Stop() {
+		t.Errorf("stop after the run ended reported as done")
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	pr, _ := newTestProcessor(prog(nop(), nop(), loadn(0, 1)), nil)
+	pr.SetJournalSize(10)
+	pr.ToggleBreakpoint(1)
+	if !pr.HasBreakpoint(1) || pr.HasBreakpoint(0) {
+		t.Fatalf("breakpoint not toggled at 1")
+	}
+
+	run := func(wantPC uint16) {
+		t.Helper()
+		var period time.Duration
+		if err := pr.RunUntilHalt(&period); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if pr.PC != wantPC {
+			t.Errorf("run stopped at %d, want %d", pr.PC, wantPC)
+		}
+	}
+
+	// the run stops before the instruction at the breakpoint, and resumes
+	// from it without stopping again
+	run(1)
+	run(4)
+
+	// stepping back stops at the breakpoint, and then at the first
+	// instruction when the journal ends
+	if err := pr.RunBackUntilBreakpoint(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pr.PC != 1 || pr.GPRRegs[0] != 0 {
+		t.Errorf("ran back to %d with r0 = %d, want 1 and 0", pr.PC, pr.GPRRegs[0])
+	}
+	if err := pr.RunBackUntilBreakpoint(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pr.PC != 0 {
+		t.Errorf("ran back to %d, want the start", pr.PC)
+	}
+	if err := pr.RunBackUntilBreakpoint(); err == nil {
+		t.Errorf("ran back with an empty journal")
+	}
+
+	// breakpoints are kept after a reset, until toggled again
+	pr.Reset()
+	run(1)
+	pr.Reset()
+	pr.ToggleBreakpoint(1)
+	run(4)
+}
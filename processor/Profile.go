@@ -0,0 +1,184 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FREncoding is the layout of the flag register in memory, used by push fr
+// and pop fr.
+type FREncoding int
+
+const (
+	// FRNative uses the bits of AllFlags, that do not match other
+	// implementations.
+	FRNative FREncoding = iota
+	// FRHardware uses the layout of the VHDL processor and the C++ simulator:
+	// greater, lesser, equal, zero, carry, overflow, division by zero, stack
+	// overflow, stack underflow and negative, from the least significant bit.
+	FRHardware
+)
+
+// DivZeroMode is what div and mod do when dividing by zero. The divZero flag
+// is set in all modes.
+type DivZeroMode int
+
+const (
+	DivZeroKeep  DivZeroMode = iota // the destination register is unchanged
+	DivZeroClear                    // the destination register becomes zero
+	DivZeroError                    // execution stops with an error
+)
+
+// BoundsMode is what memory accesses do with addresses outside of Data.
+type BoundsMode int
+
+const (
+	// BoundsError stops execution with an error, also for the last address,
+	// so that a program never depends on accesses that may be out of bounds.
+	BoundsError BoundsMode = iota
+	// BoundsWrap keeps the lower 15 bits of the address, as the hardware
+	// memory does.
+	BoundsWrap
+)
+
+// Profile selects how the parts of the ISA that were never fully specified
+// behave, so that results match a certain implementation.
+type Profile struct {
+	Name        string
+	Description string
+
+	FREncoding       FREncoding
+	SeparateOverflow bool // if false, overflow is an alias for carry
+	DivZero          DivZeroMode
+	Bounds           BoundsMode
+}
+
+// the profiles available, the first one being the default for new
+// processors.
+var Profiles = []Profile{
+	{
+		Name:        "default",
+		Description: "the original behaviour of this simulator",
+		FREncoding:  FRNative,
+		DivZero:     DivZeroKeep,
+		Bounds:      BoundsError,
+	},
+	{
+		Name:             "vhdl",
+		Description:      "the processor used in the lab FPGAs",
+		FREncoding:       FRHardware,
+		SeparateOverflow: true,
+		DivZero:          DivZeroKeep,
+		Bounds:           BoundsWrap,
+	},
+	{
+		Name:             "legacy-cpp",
+		Description:      "the C++ simulator used before this one",
+		FREncoding:       FRHardware,
+		SeparateOverflow: true,
+		DivZero:          DivZeroClear,
+		Bounds:           BoundsError,
+	},
+	{
+		Name:        "strict",
+		Description: "stops at division by zero and out of bounds addresses, and is otherwise the default",
+		FREncoding:  FRNative,
+		DivZero:     DivZeroError,
+		Bounds:      BoundsError,
+	},
+}
+
+// ProfileNames returns the names of all profiles, in order.
+func ProfileNames() []string {
+	names := make([]string, len(Profiles))
+	for i, p := range Profiles {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// ProfileByName returns the profile with a name.
+func ProfileByName(name string) (Profile, error) {
+	for _, p := range Profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Profile{}, fmt.Errorf("unknown profile %q, the profiles are %s", name,
+		strings.Join(ProfileNames(), ", "))
+}
+
+// SetProfile changes the profile of the processor, taking effect in the next
+// instruction.
+func (pr *ICMCProcessor) SetProfile(p Profile) {
+	pr.profile = p
+}
+
+// GetProfile returns the profile of the processor.
+func (pr *ICMCProcessor) GetProfile() Profile {
+	return pr.profile
+}
+
+// hardwareFlags are the flags in the order of the FRHardware bits, with zero
+// for the stack bits, that are not simulated.
+var hardwareFlags = []flagRegisterState{
+	greater, lesser, equal, zero, carry, overflow, divZero, 0, 0, negative,
+}
+
+// visibleFR returns the flag register as seen by programs: if overflow is an
+// alias for carry, the overflow bit is the carry bit.
+func (pr *ICMCProcessor) visibleFR() flagRegisterState {
+	if pr.profile.SeparateOverflow {
+		return pr.fr
+	}
+	fr := pr.fr &^ overflow
+	if fr&carry != 0 {
+		fr |= overflow
+	}
+	return fr
+}
+
+// encodeFR returns the flag register as pushed by push fr.
+func (pr *ICMCProcessor) encodeFR() uint16 {
+	if pr.profile.FREncoding == FRNative {
+		return uint16(pr.fr)
+	}
+
+	fr, v := pr.visibleFR(), uint16(0)
+	for i, f := range hardwareFlags {
+		if f != 0 && fr&f != 0 {
+			v |= 1 << i
+		}
+	}
+	return v
+}
+
+// decodeFR sets the flag register from a value popped by pop fr.
+func (pr *ICMCProcessor) decodeFR(v uint16) {
+	if pr.profile.FREncoding == FRNative {
+		pr.fr = flagRegisterState(v)
+		return
+	}
+
+	pr.fr = 0
+	for i, f := range hardwareFlags {
+		if v&(1<<i) != 0 {
+			pr.fr |= f
+		}
+	}
+	if !pr.profile.SeparateOverflow {
+		pr.fr &^= overflow
+	}
+}
+
+// checkAddress applies the bounds mode to a memory address, returning the
+// address to access or an error with the instruction name.
+func (pr *ICMCProcessor) checkAddress(loc uint16, name string) (uint16, error) {
+	if pr.profile.Bounds == BoundsWrap {
+		return loc & addrMask, nil
+	}
+	if loc >= (1<<15)-1 {
+		return 0, fmt.Errorf("%s has invalid memory as operand", name)
+	}
+	return loc, nil
+}
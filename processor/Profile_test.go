@@ -0,0 +1,138 @@
+package processor
+
+import "testing"
+
+// withProfile returns a testProgram setup that selects a profile.
+func withProfile(t *testing.T, name string) func(pr *ICMCProcessor) {
+	p, err := ProfileByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(pr *ICMCProcessor) { pr.SetProfile(p) }
+}
+
+func TestProfileByName(t *testing.T) {
+	for _, name := range ProfileNames() {
+		if p, err := ProfileByName(name); err != nil || p.Name != name {
+			t.Errorf("profile %s not found: %v", name, err)
+		}
+	}
+	if _, err := ProfileByName("z80"); err == nil {
+		t.Errorf("unknown profile found")
+	}
+
+	pr := NewEmptyProcessor(nil, nil)
+	if pr.GetProfile().Name != "default" {
+		t.Errorf("new processor with profile %s", pr.GetProfile().Name)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	setc := []uint16{encode(OpCSCARRY, 1<<9)}
+	pushFR, popFR := r(OpPUSH, 0, 1<<6), r(OpPOP, 0, 1<<6)
+	const top = (1 << 15) - 1
+
+	runPrograms(t, []testProgram{
+		{
+			name: "default push fr is native",
+			prog: prog(setc, rr(OpCMP, 0, 1), pushFR, r(OpPOP, 2, 0)),
+			regs: map[int]uint16{2: uint16(carry | equal)},
+		},
+		{
+			name:  "vhdl push fr is the hardware layout",
+			setup: withProfile(t, "vhdl"),
+			prog:  prog(setc, rr(OpCMP, 0, 1), pushFR, r(OpPOP, 2, 0)),
+			regs:  map[int]uint16{2: 1<<2 | 1<<4},
+		},
+		{
+			name:       "vhdl pop fr is the hardware layout",
+			setup:      withProfile(t, "vhdl"),
+			prog:       prog(loadn(0, 1<<0|1<<5|1<<9), r(OpPUSH, 0, 0), popFR),
+			flagsSet:   greater | overflow | negative,
+			flagsClear: carry | lesser,
+		},
+		{
+			name: "default mult sets carry, an alias for overflow",
+			// 0: loadn r1; 2: loadn r2; 4: mult; 5: jov 9; 7: loadn r3, 1
+			prog: prog(loadn(1, 0x100), loadn(2, 0x100), rrr(OpMULT, 0, 1, 2),
+				withImm(OpJMP, 11<<6, 9), loadn(3, 1)),
+			regs: map[int]uint16{3: 0}, flagsSet: carry,
+		},
+		{
+			name:  "vhdl mult sets overflow only",
+			setup: withProfile(t, "vhdl"),
+			prog: prog(loadn(1, 0x100), loadn(2, 0x100), rrr(OpMULT, 0, 1, 2),
+				withImm(OpJMP, 11<<6, 9), loadn(3, 1)),
+			regs: map[int]uint16{3: 0}, flagsSet: overflow, flagsClear: carry,
+		},
+		{
+			name:  "vhdl add does not set overflow",
+			setup: withProfile(t, "vhdl"),
+			prog: prog(loadn(1, 0xffff), loadn(2, 1), rrr(OpADD, 0, 1, 2),
+				withImm(OpJMP, 11<<6, 9), loadn(3, 1)),
+			regs: map[int]uint16{3: 1}, flagsSet: carry, flagsClear: overflow,
+		},
+		{
+			name:  "legacy-cpp div by zero clears the destination",
+			setup: withProfile(t, "legacy-cpp"),
+			prog:  prog(loadn(0, 42), rrr(OpDIV, 0, 1, 2)),
+			regs:  map[int]uint16{0: 0}, flagsSet: divZero,
+		},
+		{
+			name:  "vhdl mod by zero keeps the destination",
+			setup: withProfile(t, "vhdl"),
+			prog:  prog(loadn(0, 42), rrr(OpMOD, 0, 1, 2)),
+			regs:  map[int]uint16{0: 42}, flagsSet: divZero,
+		},
+		{
+			name:    "strict div by zero is an error",
+			setup:   withProfile(t, "strict"),
+			prog:    prog(rrr(OpDIV, 0, 1, 2)),
+			wantErr: "division by zero",
+		},
+		{
+			name:  "vhdl addresses wrap",
+			setup: withProfile(t, "vhdl"),
+			prog: prog(loadn(0, 7), withImm(OpSTORE, 0, 0x8000|100),
+				withImm(OpLOAD, 1<<7, 100)),
+			regs: map[int]uint16{1: 7}, mem: map[uint16]uint16{100: 7},
+		},
+		{
+			name:  "vhdl stack wraps",
+			setup: func(pr *ICMCProcessor) { withProfile(t, "vhdl")(pr); pr.SP = 0 },
+			prog:  prog(loadn(0, 7), r(OpPUSH, 0, 0), r(OpPOP, 1, 0)),
+			regs:  map[int]uint16{1: 7}, sp: u16(0), mem: map[uint16]uint16{0: 7},
+		},
+		{
+			name:    "strict addresses do not wrap",
+			setup:   withProfile(t, "strict"),
+			prog:    prog(withImm(OpSTORE, 0, top)),
+			wantErr: "invalid memory",
+		},
+		{
+			name:    "pop from an empty stack",
+			prog:    prog(r(OpPOP, 0, 0)),
+			wantErr: "invalid stack pointer",
+		},
+	})
+}
+
+func TestOverflowFlagAlias(t *testing.T) {
+	pr := NewEmptyProcessor(nil, nil)
+
+	pr.SetFlag(FlagOverflow, true)
+	if !pr.GetFlag(FlagCarry) || !pr.GetFlag(FlagOverflow) {
+		t.Errorf("overflow is not an alias for carry in the default profile")
+	}
+
+	p, _ := ProfileByName("vhdl")
+	pr.SetProfile(p)
+	if pr.GetFlag(FlagOverflow) {
+		t.Errorf("overflow set from the carry with a separate overflow flag")
+	}
+	pr.SetFlag(FlagOverflow, true)
+	pr.SetFlag(FlagCarry, false)
+	if !pr.GetFlag(FlagOverflow) {
+		t.Errorf("overflow not set with a separate overflow flag")
+	}
+}
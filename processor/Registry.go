@@ -0,0 +1,178 @@
+package processor
+
+import "fmt"
+
+// subInstruction is an instruction that shares an opcode with others, being
+// run only for the words where word&mask == value.
+type subInstruction struct {
+	inst  Instruction
+	mask  uint16
+	value uint16
+}
+
+// subInstructions are all instructions registered with a sub-opcode.
+var subInstructions []subInstruction
+
+// subTable indexes subInstructions by opcode, built with the opcode table.
+var subTable [64][]*subInstruction
+
+// opcodeMask are the bits of an instruction word with the opcode.
+const opcodeMask = 0b111111 << 10
+
+// checkInstruction returns an error if an instruction can't be registered.
+func checkInstruction(inst Instruction) error {
+	if inst.Op >= 64 {
+		return fmt.Errorf("invalid opcode %d", inst.Op)
+	}
+	if inst.GenMnemonic == nil || inst.Execute == nil {
+		return fmt.Errorf("instruction with opcode %06b has no mnemonic or "+
+			"execute function", inst.Op)
+	}
+	if inst.Size > 2 {
+		return fmt.Errorf("instruction with opcode %06b has %d words, the "+
+			"maximum is 2", inst.Op, inst.Size)
+	}
+	return nil
+}
+
+// RegisterInstruction adds an instruction to the ISA, so that extensions can
+// be defined by programs using the simulator instead of editing
+// AllInstructions. It fails if another instruction already uses the opcode;
+// to share an opcode, use RegisterSubInstruction.
+// Instructions must not be registered while a processor is running.
+func RegisterInstruction(inst Instruction) error {
+	if err := checkInstruction(inst); err != nil {
+		return err
+	}
+	for _, other := range AllInstructions {
+		if other.Op == inst.Op {
+			return fmt.Errorf("opcode %06b is already used by %q", inst.Op,
+				other.GenMnemonic(uint16(inst.Op)<<10))
+		}
+	}
+
+	// a new array is used, so that the opcode table is not left pointing to
+	// instructions that could be overwritten by another append
+	AllInstructions = append(AllInstructions[:len(AllInstructions):len(AllInstructions)],
+		inst)
+	RebuildOpcodeTable()
+	return nil
+}
+
+// UnregisterInstruction removes the instruction with an opcode added to
+// AllInstructions, built in or registered. Instructions registered with
+// RegisterSubInstruction are kept.
+func UnregisterInstruction(op Opcode) error {
+	for i, inst := range AllInstructions {
+		if inst.Op != op {
+			continue
+		}
+
+		insts := make([]Instruction, 0, len(AllInstructions)-1)
+		insts = append(insts, AllInstructions[:i]...)
+		AllInstructions = append(insts, AllInstructions[i+1:]...)
+		RebuildOpcodeTable()
+		return nil
+	}
+	return fmt.Errorf("no instruction with opcode %06b", op)
+}
+
+// RegisterSubInstruction adds an instruction that shares it's opcode, run for
+// the instruction words where word&mask == value. The mask selects bits other
+// than the opcode, such as the ones that tell apart the variants of OpROTSH
+// and OpCSCARRY. It takes precedence over the instruction in AllInstructions
+// with the same opcode (if any) for the words it matches, and fails if
+// another sub-instruction of the opcode could match the same words.
+// Instructions must not be registered while a processor is running.
+func RegisterSubInstruction(inst Instruction, mask, value uint16) error {
+	if err := checkInstruction(inst); err != nil {
+		return err
+	}
+	if mask == 0 || mask&opcodeMask != 0 {
+		return fmt.Errorf("invalid sub-opcode mask %016b", mask)
+	}
+	if value&^mask != 0 {
+		return fmt.Errorf("sub-opcode value %016b has bits outside the mask "+
+			"%016b", value, mask)
+	}
+
+	for _, other := range subInstructions {
+		// two sub-instructions match the same word if their values agree in
+		// all bits both masks select
+		common := mask & other.mask
+		if other.inst.Op == inst.Op && value&common == other.value&common {
+			return fmt.Errorf("sub-opcode %016b of opcode %06b overlaps %q",
+				value, inst.Op, other.inst.GenMnemonic(uint16(inst.Op)<<10|other.value))
+		}
+	}
+
+	subInstructions = append(subInstructions, subInstruction{inst, mask, value})
+	RebuildOpcodeTable()
+	return nil
+}
+
+// UnregisterSubInstruction removes an instruction added by
+// RegisterSubInstruction, with the same opcode, mask and value.
+func UnregisterSubInstruction(op Opcode, mask, value uint16) error {
+	for i, sub := range subInstructions {
+		if sub.inst.Op != op || sub.mask != mask || sub.value != value {
+			continue
+		}
+
+		subInstructions = append(subInstructions[:i:i], subInstructions[i+1:]...)
+		RebuildOpcodeTable()
+		return nil
+	}
+	return fmt.Errorf("no instruction with opcode %06b and sub-opcode %016b",
+		op, value)
+}
+
+// RegAt returns the index of the register in an instruction word starting at
+// bit, such as 7, 4 and 1 for the registers of ALU instructions. It is meant
+// for the Execute functions of registered instructions.
+func RegAt(inst uint16, bit int) uint16 {
+	return getRegAt(inst, bit)
+}
+
+// RegMnemonic returns a GenMnemonic function for an instruction with numRegs
+// register operands at bits 7, 4 and 1, in that order.
+func RegMnemonic(m string, numRegs int) func(uint16) string {
+	return genRegM(m, numRegs)
+}
+
+// the methods below access memory from the Execute function of a registered
+// instruction as the built in instructions do: writes are journaled for
+// StepBack and traced, watchpoints are checked, and loads and stores go
+// through the devices mapped. Accessing Data directly skips all of that.
+// They must only be called while an instruction runs, WriteMemory is used
+// otherwise.
+
+// Load reads a word as the load instruction does, with the address checked
+// by the profile.
+func (pr *ICMCProcessor) Load(addr uint16) (uint16, error) {
+	loc, err := pr.checkAddress(addr, "instruction")
+	if err != nil {
+		return 0, err
+	}
+	return pr.load(loc)
+}
+
+// Store writes a word as the store instruction does, with the address
+// checked by the profile.
+func (pr *ICMCProcessor) Store(addr, v uint16) error {
+	loc, err := pr.checkAddress(addr, "instruction")
+	if err != nil {
+		return err
+	}
+	return pr.store(loc, v)
+}
+
+// Push writes a word at the top of the stack as the push instruction does.
+func (pr *ICMCProcessor) Push(v uint16) error {
+	return pr.push(v)
+}
+
+// Pop reads the word at the top of the stack as the pop instruction does.
+func (pr *ICMCProcessor) Pop() (uint16, error) {
+	return pr.pop()
+}
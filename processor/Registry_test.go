@@ -0,0 +1,176 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// execINCMOD is the example instruction of the documentation, rx = (rx+1)%ry.
+func execINCMOD(pr *ICMCProcessor) error {
+	inst := pr.Data[pr.PC]
+	rx, ry := RegAt(inst, 7), RegAt(inst, 4)
+	pr.GPRRegs[rx] = (pr.GPRRegs[rx] + 1) % pr.GPRRegs[ry]
+	return nil
+}
+
+const opINCMOD = 0b111111
+
+func TestRegisterInstruction(t *testing.T) {
+	incmod := Instruction{opINCMOD, RegMnemonic("incmod", 2), 1, 3, execINCMOD}
+
+	program := prog(loadn(0, 4), loadn(1, 5), rr(opINCMOD, 0, 1),
+		rr(opINCMOD, 0, 1))
+
+	// the word is invalid before registering, and cached as such
+	pr, _ := newTestProcessor(program, nil)
+	pr.PC = 4
+	if err := pr.RunInstruction(); err == nil {
+		t.Fatalf("unregistered instruction ran")
+	}
+
+	if err := RegisterInstruction(incmod); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer UnregisterInstruction(opINCMOD)
+
+	runProgram(t, testProgram{prog: program, regs: map[int]uint16{0: 1}})
+
+	pr.PC, pr.GPRRegs[1] = 4, 5
+	if err := pr.RunInstruction(); err != nil {
+		t.Errorf("registered instruction decoded before failed: %v", err)
+	}
+	if m := pr.GetMnemonic(4, 1); m != "incmod R0, R1" {
+		t.Errorf("mnemonic %q, want \"incmod R0, R1\"", m)
+	}
+
+	err := RegisterInstruction(incmod)
+	if err == nil || !strings.Contains(err.Error(), "incmod") {
+		t.Errorf("got error %v registering the same opcode twice", err)
+	}
+	if err = RegisterInstruction(Instruction{Op: OpADD, Size: 1}); err == nil {
+		t.Errorf("instruction without functions registered")
+	}
+	incmod.Op = 64
+	if err = RegisterInstruction(incmod); err == nil {
+		t.Errorf("instruction with an invalid opcode registered")
+	}
+
+	if err = UnregisterInstruction(opINCMOD); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := fetchInstruction(opINCMOD << 10); ok {
+		t.Errorf("unregistered instruction still fetched")
+	}
+	if err = UnregisterInstruction(opINCMOD); err == nil {
+		t.Errorf("instruction unregistered twice")
+	}
+}
+
+func TestRegisterSubInstruction(t *testing.T) {
+	// swapc inverts the carry, using bit 8 of the opcode of setc and clearc
+	swapc := Instruction{OpCSCARRY, RegMnemonic("swapc", 0), 1, 2,
+		func(pr *ICMCProcessor) error {
+			pr.fr ^= carry
+			return nil
+		},
+	}
+	const mask, value = 1 << 8, 1 << 8
+
+	if err := RegisterSubInstruction(swapc, mask, value); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer UnregisterSubInstruction(OpCSCARRY, mask, value)
+
+	swap := []uint16{encode(OpCSCARRY, value)}
+	setc := []uint16{encode(OpCSCARRY, 1<<9)}
+	runPrograms(t, []testProgram{
+		{name: "swapc sets", prog: prog(swap), flagsSet: carry},
+		{name: "swapc clears", prog: prog(setc, swap), flagsClear: carry},
+		{name: "setc still works", prog: prog(setc), flagsSet: carry},
+	})
+
+	if m := Disassemble(swap[0]); m != "swapc " {
+		t.Errorf("mnemonic %q, want \"swapc \"", m)
+	}
+
+	// the same bits, or a mask that could match the same words, collide
+	if err := RegisterSubInstruction(swapc, mask, value); err == nil {
+		t.Errorf("sub-opcode registered twice")
+	}
+	if err := RegisterSubInstruction(swapc, mask|1, value); err == nil {
+		t.Errorf("overlapping sub-opcode registered")
+	}
+	if err := RegisterSubInstruction(swapc, mask|1, 1); err != nil {
+		t.Errorf("sub-opcode not overlapping failed: %v", err)
+	} else {
+		UnregisterSubInstruction(OpCSCARRY, mask|1, 1)
+	}
+
+	if err := RegisterSubInstruction(swapc, 1<<10, 0); err == nil {
+		t.Errorf("mask with opcode bits accepted")
+	}
+	if err := RegisterSubInstruction(swapc, mask, 1); err == nil {
+		t.Errorf("value outside the mask accepted")
+	}
+
+	if err := UnregisterSubInstruction(OpCSCARRY, mask, value); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m := Disassemble(swap[0]); m != "clearc" {
+		t.Errorf("mnemonic %q after unregistering, want \"clearc\"", m)
+	}
+}
+
+func TestRegisteredMemoryAccess(t *testing.T) {
+	// xchg swaps rx with the word at the address in ry
+	const opXCHG = 0b111111
+	xchg := Instruction{
+		Op:          opXCHG,
+		GenMnemonic: RegMnemonic("xchg", 2),
+		Size:        1,
+		Cycles:      4,
+		Execute: func(pr *ICMCProcessor) error {
+			inst := pr.Data[pr.PC]
+			rx, ry := RegAt(inst, 7), RegAt(inst, 4)
+			v, err := pr.Load(pr.GPRRegs[ry])
+			if err != nil {
+				return err
+			}
+			if err = pr.Store(pr.GPRRegs[ry], pr.GPRRegs[rx]); err != nil {
+				return err
+			}
+			pr.GPRRegs[rx] = v
+			return nil
+		},
+	}
+	if err := RegisterInstruction(xchg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer UnregisterInstruction(opXCHG)
+
+	pr, _ := newTestProcessor(prog(loadn(0, 9), loadn(1, 100), rr(opXCHG, 0, 1)), nil)
+	pr.SetJournalSize(10)
+	pr.Data[100] = 7
+	pr.AddWatchpoint(Watchpoint{100, 100, WatchWrite})
+
+	var period time.Duration
+	if err := pr.RunUntilHalt(&period); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pr.Data[100] != 9 || pr.GPRRegs[0] != 7 {
+		t.Errorf("xchg left Data[100] = %d and r0 = %d, want 9 and 7",
+			pr.Data[100], pr.GPRRegs[0])
+	}
+	if hit, ok := pr.LastWatchHit(); !ok || hit != (WatchHit{4, 100, WatchWrite, 7, 9}) {
+		t.Errorf("watchpoint hit %+v, %v", hit, ok)
+	}
+
+	if err := pr.StepBack(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pr.Data[100] != 7 || pr.GPRRegs[0] != 9 {
+		t.Errorf("step back left Data[100] = %d and r0 = %d, want 7 and 9",
+			pr.Data[100], pr.GPRRegs[0])
+	}
+}
@@ -4,9 +4,9 @@ import "fmt"
 
 func genCSCARRYM(inst uint16) string {
 	if inst&(1<<9) != 0 {
-		return "clearc"
-	} else {
 		return "setc"
+	} else {
+		return "clearc"
 	}
 }
 
@@ -14,9 +14,7 @@ func execINCHAR(pr *ICMCProcessor) error {
 	// because inchar is dependent on the environment (for instance, the visual
 	// toolkit used), the ICMCProcessor just calls a hook that must be defined.
 
-	inst := pr.Data[pr.PC]
-
-	RD := getRegAt(inst, 7)
+	RD := pr.cur.rd
 	v, err := pr.inChar()
 	if err != nil {
 		return err
@@ -30,17 +28,22 @@ func execOUTCHAR(pr *ICMCProcessor) error {
 	// because outchar is dependent on the environment (for instance, the visual
 	// toolkit used), the ICMCProcessor just calls a hook that must be defined.
 
-	inst := pr.Data[pr.PC]
+	RS1 := pr.cur.rd
+	RS2 := pr.cur.rs1
 
-	RS1 := getRegAt(inst, 7)
-	RS2 := getRegAt(inst, 4)
+	char, pos := pr.GPRRegs[RS1], pr.GPRRegs[RS2]
+	if err := pr.outChar(char, pos); err != nil {
+		return err
+	}
 
-	return pr.outChar(pr.GPRRegs[RS1], pr.GPRRegs[RS2])
+	// keep track of the character written so that it can be undone
+	pr.recordOutChar(char, pos)
+	return nil
 }
 
 func execCSCARRY(pr *ICMCProcessor) error {
-	if pr.Data[pr.PC]&(1<<9) != 0 {
-		pr.fr &= carry
+	if pr.cur.word&(1<<9) != 0 {
+		pr.fr |= carry
 	} else {
 		pr.fr &= ^carry
 	}
@@ -0,0 +1,87 @@
+package processor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpecial(t *testing.T) {
+	runPrograms(t, []testProgram{
+		{
+			name:  "inchar",
+			prog:  prog(r(OpINCHAR, 0, 0), r(OpINCHAR, 1, 0), r(OpINCHAR, 2, 0)),
+			input: []byte("ab"),
+			regs:  map[int]uint16{0: 'a', 1: 'b', 2: 255},
+		},
+		{
+			name:   "outchar",
+			prog:   prog(loadn(0, 'H'|2<<8), loadn(1, 41), rr(OpOUTCHAR, 0, 1)),
+			screen: map[uint16]uint16{41: 'H' | 2<<8},
+		},
+		{
+			name:     "setc",
+			prog:     prog([]uint16{encode(OpCSCARRY, 1<<9)}),
+			flagsSet: carry,
+		},
+		{
+			name: "clearc",
+			prog: prog([]uint16{encode(OpCSCARRY, 1<<9)},
+				[]uint16{encode(OpCSCARRY, 0)}),
+			flagsClear: carry,
+		},
+		{
+			name: "nop",
+			prog: prog(nop(), nop(), loadn(0, 1)),
+			regs: map[int]uint16{0: 1},
+		},
+	})
+
+	if m := genCSCARRYM(encode(OpCSCARRY, 1<<9)); m != "setc" {
+		t.Errorf("setc disassembled as %s", m)
+	}
+	if m := genCSCARRYM(encode(OpCSCARRY, 0)); m != "clearc" {
+		t.Errorf("clearc disassembled as %s", m)
+	}
+}
+
+func TestBreakpStops(t *testing.T) {
+	pr, _ := newTestProcessor(prog(loadn(0, 1),
+		[]uint16{encode(OpBREAKP, 0)}, loadn(0, 2)), nil)
+
+	var period time.Duration
+	if err := pr.RunUntilHalt(&period); err != nil {
+		t.Fatal(err)
+	}
+	if pr.PC != 3 || pr.GPRRegs[0] != 1 {
+		t.Fatalf("stopped at PC %d with R0 = %d, want PC 3 and R0 = 1",
+			pr.PC, pr.GPRRegs[0])
+	}
+
+	// running again resumes after the breakp
+	if err := pr.RunUntilHalt(&period); err != nil {
+		t.Fatal(err)
+	}
+	if pr.GPRRegs[0] != 2 {
+		t.Errorf("R0 = %d after resuming, want 2", pr.GPRRegs[0])
+	}
+}
+
+func TestInvalidOpcode(t *testing.T) {
+	pr, _ := newTestProcessor([]uint16{encode(0b111111, 0)}, nil)
+	if err := pr.RunInstruction(); err == nil {
+		t.Errorf("invalid opcode executed without an error")
+	}
+	if pr.PC != 1 {
+		t.Errorf("PC = %d after an invalid opcode, want 1", pr.PC)
+	}
+}
+
+func TestMnemonicsDontPanic(t *testing.T) {
+	pr, _ := newTestProcessor(nil, nil)
+	for i := 0; i < 1<<16; i++ {
+		pr.Data[0] = uint16(i)
+		if pr.GetMnemonic(0, 0) == "" {
+			t.Fatalf("empty mnemonic for %016b", i)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package processor
+
+// TraceKind tells what caused the changes a TraceRecord describes.
+type TraceKind byte
+
+const (
+	TraceInst      TraceKind = iota // an instruction run
+	TraceEdit                       // a Data word written with WriteMemory
+	TraceInterrupt                  // an interrupt taken, pushing PC and FR
+)
+
+// TraceRecord describes the execution of a single instruction, as sent to a
+// Tracer. Edits made with WriteMemory and interrupts taken are also traced,
+// with their own Kind and no instruction.
+type TraceRecord struct {
+	Kind TraceKind
+
+	PC      uint16 // address of the instruction
+	Inst    uint16 // the instruction word
+	Operand uint16 // the second word, for instructions with size 2
+	Size    byte   // the instruction size in words
+
+	Regs  [8]uint16 // the register file after execution
+	SP    uint16    // the stack pointer after execution
+	OldFR uint16    // the flag register before execution
+	FR    uint16    // the flag register after execution
+
+	MemWrites byte      // the number of Data words written, at most 2
+	MemAddr   [2]uint16 // the addresses written, in order
+	MemValue  [2]uint16 // the values written
+}
+
+// Mnemonic returns the mnemonic of the instruction run, "edit" for an edit or
+// "int" for an interrupt.
+func (r *TraceRecord) Mnemonic() string {
+	switch r.Kind {
+	case TraceEdit:
+		return "edit"
+	case TraceInterrupt:
+		return "int"
+	}
+	return Disassemble(r.Inst)
+}
+
+// Tracer receives a record of every instruction run by the processor. If
+// Trace returns an error, the instruction returns it, stopping RunUntilHalt.
+type Tracer interface {
+	Trace(r *TraceRecord) error
+}
+
+// SetTracer sets the tracer that receives every instruction run, or disables
+// tracing if t is nil. It must not be called while the processor is running.
+func (pr *ICMCProcessor) SetTracer(t Tracer) {
+	pr.tracer = t
+}
+
+// Disassemble returns the mnemonic of an instruction word, as shown in the
+// instruction list, without it's operand word.
+func Disassemble(inst uint16) string {
+	i, ok := fetchInstruction(inst)
+	if !ok {
+		return "<invalid opcode>"
+	}
+	return i.GenMnemonic(inst)
+}
+
+// startTrace fills the part of the trace record known before execution. The
+// record is kept in the processor, as a local one would be allocated for every
+// instruction.
+func (pr *ICMCProcessor) startTrace(inst *Instruction) {
+	if inst == &interruptInst {
+		pr.traceRec = TraceRecord{Kind: TraceInterrupt, PC: pr.PC,
+			OldFR: uint16(pr.fr)}
+		return
+	}
+
+	pr.traceRec = TraceRecord{
+		PC:    pr.PC,
+		Inst:  pr.Data[pr.PC],
+		Size:  inst.Size,
+		OldFR: uint16(pr.fr),
+	}
+	if inst.Size == 2 && pr.PC < (1<<15)-1 {
+		pr.traceRec.Operand = pr.Data[pr.PC+1]
+	}
+}
+
+// endTrace fills the rest of the trace record after execution and sends it to
+// the tracer.
+func (pr *ICMCProcessor) endTrace() error {
+	rec := &pr.traceRec
+	rec.Regs = pr.GPRRegs
+	rec.SP = pr.SP
+	rec.FR = uint16(pr.fr)
+
+	rec.MemWrites = byte(pr.wrote)
+	rec.MemAddr = pr.wroteAt
+	rec.MemValue = pr.wroteValue
+
+	return pr.tracer.Trace(rec)
+}
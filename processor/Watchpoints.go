@@ -0,0 +1,126 @@
+package processor
+
+import "fmt"
+
+// WatchKind defines which memory accesses trigger a watchpoint.
+type WatchKind int
+
+const (
+	WatchRead WatchKind = 1 << iota
+	WatchWrite
+	WatchReadWrite = WatchRead | WatchWrite
+)
+
+func (k WatchKind) String() string {
+	switch k {
+	case WatchRead:
+		return "read"
+	case WatchWrite:
+		return "write"
+	case WatchReadWrite:
+		return "read/write"
+	}
+	return fmt.Sprintf("(unknown watch kind %d)", int(k))
+}
+
+// Watchpoint describes an inclusive range of Data addresses that stop
+// RunUntilHalt when accessed by a load, store, stack or call instruction.
+type Watchpoint struct {
+	Start uint16
+	End   uint16
+	Kind  WatchKind
+}
+
+func (w Watchpoint) String() string {
+	if w.Start == w.End {
+		return fmt.Sprintf("%.5d (%v)", w.Start, w.Kind)
+	}
+	return fmt.Sprintf("%.5d..%.5d (%v)", w.Start, w.End, w.Kind)
+}
+
+// WatchHit describes the access that triggered a watchpoint. For reads, Old
+// and New are both the value read.
+type WatchHit struct {
+	PC   uint16 // address of the instruction that accessed memory
+	Addr uint16
+	Kind WatchKind // either WatchRead or WatchWrite
+	Old  uint16
+	New  uint16
+}
+
+func (h WatchHit) String() string {
+	if h.Kind == WatchRead {
+		return fmt.Sprintf("instruction at %.5d read %d from address %.5d",
+			h.PC, h.Old, h.Addr)
+	}
+	return fmt.Sprintf("instruction at %.5d wrote address %.5d: %d -> %d",
+		h.PC, h.Addr, h.Old, h.New)
+}
+
+// AddWatchpoint adds a new watchpoint to the processor. It must not be called
+// while the processor is running.
+func (pr *ICMCProcessor) AddWatchpoint(w Watchpoint) error {
+	if w.End < w.Start {
+		return fmt.Errorf("watchpoint end must not be before it's start")
+	}
+	if w.Kind&WatchReadWrite == 0 {
+		return fmt.Errorf("watchpoint must trigger on read, write or both")
+	}
+
+	pr.watchpoints = append(pr.watchpoints, w)
+	return nil
+}
+
+// RemoveWatchpoint removes the watchpoint at index i of Watchpoints. It must
+// not be called while the processor is running.
+func (pr *ICMCProcessor) RemoveWatchpoint(i int) {
+	pr.watchpoints = append(pr.watchpoints[:i], pr.watchpoints[i+1:]...)
+}
+
+// Watchpoints returns all watchpoints defined.
+func (pr *ICMCProcessor) Watchpoints() []Watchpoint {
+	return pr.watchpoints
+}
+
+// LastWatchHit returns the watchpoint triggered by the last instruction run,
+// if any.
+func (pr *ICMCProcessor) LastWatchHit() (WatchHit, bool) {
+	if pr.watchHit == nil {
+		return WatchHit{}, false
+	}
+	return *pr.watchHit, true
+}
+
+// checkWatch records a watchpoint hit if an access of a certain kind to addr
+// is being watched.
+func (pr *ICMCProcessor) checkWatch(addr uint16, kind WatchKind, old, new uint16) {
+	for _, w := range pr.watchpoints {
+		if w.Kind&kind != 0 && addr >= w.Start && addr <= w.End {
+			pr.watchHit = &WatchHit{pr.PC, addr, kind, old, new}
+			return
+		}
+	}
+}
+
+// readData reads a word from Data as a data access, checking watchpoints.
+func (pr *ICMCProcessor) readData(addr uint16) uint16 {
+	v := pr.Data[addr]
+	if len(pr.watchpoints) != 0 {
+		pr.checkWatch(addr, WatchRead, v, v)
+	}
+	return v
+}
+
+// writeData writes a word to Data as a data access, checking watchpoints and
+// recording the old value in the journal.
+func (pr *ICMCProcessor) writeData(addr, v uint16) {
+	if len(pr.watchpoints) != 0 {
+		pr.checkWatch(addr, WatchWrite, pr.Data[addr], v)
+	}
+	pr.recordWrite(addr)
+	if pr.wrote < len(pr.wroteAt) {
+		pr.wroteAt[pr.wrote], pr.wroteValue[pr.wrote] = addr, v
+		pr.wrote++
+	}
+	pr.Data[addr] = v
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchpoints(t *testing.T) {
+	const top = (1 << 15) - 1
+
+	tests := []struct {
+		name   string
+		prog   []uint16
+		watch  Watchpoint
+		want   WatchHit
+		stopPC uint16 // the address after the instruction that hit
+	}{
+		{
+			name:   "load",
+			prog:   prog(withImm(OpLOAD, 1<<7, 100), nop()),
+			watch:  Watchpoint{100, 100, WatchRead},
+			want:   WatchHit{0, 100, WatchRead, 7, 7},
+			stopPC: 2,
+		},
+		{
+			name:   "store",
+			prog:   prog(loadn(1, 9), withImm(OpSTORE, 1<<7, 100), nop()),
+			watch:  Watchpoint{100, 100, WatchWrite},
+			want:   WatchHit{2, 100, WatchWrite, 7, 9},
+			stopPC: 4,
+		},
+		{
+			name:   "loadi",
+			prog:   prog(loadn(0, 100), rr(OpLOADI, 1, 0), nop()),
+			watch:  Watchpoint{90, 110, WatchReadWrite},
+			want:   WatchHit{2, 100, WatchRead, 7, 7},
+			stopPC: 3,
+		},
+		{
+			name:   "storei",
+			prog:   prog(loadn(0, 100), loadn(1, 9), rr(OpSTOREI, 0, 1), nop()),
+			watch:  Watchpoint{100, 100, WatchReadWrite},
+			want:   WatchHit{4, 100, WatchWrite, 7, 9},
+			stopPC: 5,
+		},
+		{
+			name:   "push",
+			prog:   prog(loadn(0, 9), r(OpPUSH, 0, 0), nop()),
+			watch:  Watchpoint{top, top, WatchWrite},
+			want:   WatchHit{2, top, WatchWrite, 7, 9},
+			stopPC: 3,
+		},
+		{
+			// the write of the push does not trigger a read watchpoint
+			name:   "pop",
+			prog:   prog(loadn(0, 9), r(OpPUSH, 0, 0), r(OpPOP, 1, 0), nop()),
+			watch:  Watchpoint{top, top, WatchRead},
+			want:   WatchHit{3, top, WatchRead, 9, 9},
+			stopPC: 4,
+		},
+		{
+			name:   "call",
+			prog:   append(prog(withImm(OpCALL, 0, 3)), nop()...),
+			watch:  Watchpoint{top, top, WatchWrite},
+			want:   WatchHit{0, top, WatchWrite, 7, 2},
+			stopPC: 3,
+		},
+		{
+			name:   "rts",
+			prog:   append(prog(withImm(OpCALL, 0, 3)), encode(OpRTS, 0)),
+			watch:  Watchpoint{top, top, WatchRead},
+			want:   WatchHit{3, top, WatchRead, 2, 2},
+			stopPC: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr, _ := newTestProcessor(tt.prog, nil)
+			pr.Data[100], pr.Data[top] = 7, 7
+			if err := pr.AddWatchpoint(tt.watch); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var period time.Duration
+			if err := pr.RunUntilHalt(&period); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if pr.PC != tt.stopPC {
+				t.Errorf("run stopped at %d, want %d", pr.PC, tt.stopPC)
+			}
+			if hit, ok := pr.LastWatchHit(); !ok || hit != tt.want {
+				t.Errorf("watchpoint hit %+v, %v, want %+v", hit, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+; exercises the ALU, including the carry variants and division by zero
+	loadn r0, #65535
+	loadn r1, #2
+	add r2, r0, r1 ; 1 with carry
+	addc r3, r1, r1 ; 2 + 2 + carry
+	sub r4, r1, r0 ; borrow
+	mult r5, r1, r1
+	loadn r6, #17
+	loadn r7, #5
+	mod r6, r6, r7
+	div r7, r1, r1
+	loadn r0, #0
+	div r1, r1, r0 ; divide by zero, r1 is kept
+	jdz dz
+	halt
+dz:
+	loadn r0, #0x1234
+	rotr r0, #4
+	shiftl1 r0, #1
+	not r1, r1
+	xor r7, r7, r1
+	setc
+	halt
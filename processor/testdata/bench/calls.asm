@@ -0,0 +1,20 @@
+; calls a subroutine that uses the stack many times
+	loadn r0, #0
+	loadn r1, #20000
+loop:
+	call work
+	cmp r0, r1
+	jne loop
+	halt
+
+work:
+	push r2
+	push fr
+	loadn r2, #3
+	mult r2, r2, r2
+	add r0, r0, r2
+	sub r0, r0, r2
+	inc r0
+	pop fr
+	pop r2
+	rts
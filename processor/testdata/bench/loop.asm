@@ -0,0 +1,8 @@
+; a tight counting loop, mostly inc, cmp and jumps
+	loadn r0, #0
+	loadn r1, #50000
+loop:
+	inc r0
+	cmp r0, r1
+	jne loop
+	halt
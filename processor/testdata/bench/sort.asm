@@ -0,0 +1,43 @@
+; bubble sorts an array in reverse order, mostly memory and ALU instructions
+jmp main
+n: var #1
+static n + #0, #200
+arr: var #200
+
+main:
+	; fill arr with n, n-1, ..., 1
+	load r7, n
+	loadn r0, #arr
+	mov r1, r7
+fill:
+	storei r0, r1
+	inc r0
+	dec r1
+	loadn r2, #0
+	cmp r1, r2
+	jne fill
+
+	; for i = n-1 down to 1, bubble the largest to the end
+	dec r7
+outer:
+	loadn r0, #arr
+	loadn r6, #0
+inner:
+	loadi r2, r0
+	inc r0
+	loadi r3, r0
+	cmp r2, r3
+	jel noswap
+	storei r0, r2
+	dec r0
+	storei r0, r3
+	inc r0
+noswap:
+	inc r6
+	cmp r6, r7
+	jne inner
+	dec r7
+	loadn r2, #0
+	cmp r7, r2
+	jne outer
+	halt
@@ -0,0 +1,40 @@
+; prints two strings through a subroutine that saves the registers it uses
+jmp main
+str1: string "call"
+str2: string "rts"
+
+main:
+	loadn r0, #str1
+	loadn r1, #0
+	call print
+	loadn r0, #str2
+	loadn r1, #40
+	call print
+	inchar r7
+	loadn r1, #80
+	outchar r7, r1
+	halt
+
+; print writes the 0 terminated string at r0 starting at position r1.
+print:
+	push r0
+	push r1
+	push r2
+	push r3
+	push fr
+	loadn r3, #0
+print_loop:
+	loadi r2, r0
+	cmp r2, r3
+	jeq print_end
+	outchar r2, r1
+	inc r0
+	inc r1
+	jmp print_loop
+print_end:
+	pop fr
+	pop r3
+	pop r2
+	pop r1
+	pop r0
+	rts
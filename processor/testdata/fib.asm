@@ -0,0 +1,25 @@
+; computes the first 12 fibonacci numbers into fibs, r0 ends with the last one
+jmp main
+fibs: var #12
+
+main:
+	loadn r0, #0
+	loadn r1, #1
+	loadn r5, #fibs
+	loadn r6, #12
+	loadn r7, #0
+loop:
+	storei r5, r0
+	add r2, r0, r1
+	mov r0, r1
+	mov r1, r2
+	inc r5
+	inc r7
+	cmp r7, r6
+	jne loop
+
+	loadn r5, #fibs
+	loadn r4, #11
+	add r5, r5, r4
+	loadi r0, r5
+	halt
@@ -0,0 +1,14 @@
+jmp main
+msg: string "Hello"
+main:
+	loadn r0, #msg
+	loadn r1, #0
+	loadn r3, #0
+loop: loadi r2, r0
+	cmp r2, r3
+	jeq end
+	outchar r2, r1
+	inc r0
+	inc r1
+	jmp loop
+end: halt
@@ -0,0 +1,322 @@
+// package snapshot implements saving and restoring the full state of the ICMC
+// simulator (processor, screen and character mapping) to a versioned file.
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+)
+
+// Version is the current version of the snapshot file format. Older versions
+// must still be readable when the format changes.
+const Version = 4
+
+// magic identifies a snapshot file.
+var magic = [8]byte{'I', 'C', 'M', 'C', 'S', 'N', 'A', 'P'}
+
+// Snapshot is the full state of a simulator. Everything is stored in big
+// endian order after the magic and version: the Machine fields in order, the
+// number of devices as an uint16 and each DeviceState.
+type Snapshot struct {
+	Machine
+	Devices []DeviceState // since version 4
+}
+
+// Machine is the part of a snapshot with a fixed size, with the processor,
+// screen and char map.
+type Machine struct {
+	Code      [1 << 15]uint16
+	Data      [1 << 15]uint16
+	GPRRegs   [8]uint16
+	SP        uint16
+	PC        uint16
+	FR        uint16
+	InstCount uint64
+
+	Screen     [30][40]uint16 // characters drawn, with their color in the higher byte
+	HasCharMap bool           // if CharMap is defined, else the current one is kept
+	CharMap    [128 * 8]byte  // the charmap as read from a char MIF
+
+	CycleCount uint64 // since version 2
+
+	IntVector  uint16 // since version 3
+	IntEnabled bool
+	IntPending bool
+
+	Profile [32]byte // since version 4, the ISA profile name padded with zeros
+}
+
+// DeviceState is the state of a processor.StatefulDevice, stored as the start
+// and end of the range it is mapped to, the number of words in the state as an
+// uint16 and the words.
+type DeviceState struct {
+	Start uint16
+	End   uint16
+	State []uint16
+}
+
+// snapshotV1 is the layout of a version 1 snapshot, before CycleCount.
+type snapshotV1 struct {
+	Code      [1 << 15]uint16
+	Data      [1 << 15]uint16
+	GPRRegs   [8]uint16
+	SP        uint16
+	PC        uint16
+	FR        uint16
+	InstCount uint64
+
+	Screen     [30][40]uint16
+	HasCharMap bool
+	CharMap    [128 * 8]byte
+}
+
+// snapshotV2 is the layout of a version 2 snapshot, before the interrupt
+// state.
+type snapshotV2 struct {
+	snapshotV1
+	CycleCount uint64
+}
+
+// snapshotV3 is the layout of a version 3 snapshot, before the profile and
+// the devices.
+type snapshotV3 struct {
+	snapshotV2
+	IntVector  uint16
+	IntEnabled bool
+	IntPending bool
+}
+
+// snapshot converts an old snapshot to the current version.
+func (old *snapshotV1) snapshot() *Snapshot {
+	return &Snapshot{Machine: Machine{
+		Code:       old.Code,
+		Data:       old.Data,
+		GPRRegs:    old.GPRRegs,
+		SP:         old.SP,
+		PC:         old.PC,
+		FR:         old.FR,
+		InstCount:  old.InstCount,
+		Screen:     old.Screen,
+		HasCharMap: old.HasCharMap,
+		CharMap:    old.CharMap,
+	}}
+}
+
+// header starts every snapshot file.
+type header struct {
+	Magic   [8]byte
+	Version uint16
+}
+
+// FromProcessor creates a snapshot with the processor state, including the
+// devices mapped. The screen and char map must be filled by the caller. It
+// fails if a device is not a processor.StatefulDevice, as it's state would be
+// lost.
+func FromProcessor(pr *processor.ICMCProcessor) (*Snapshot, error) {
+	s := &Snapshot{Machine: Machine{
+		Code:      pr.Code,
+		Data:      pr.Data,
+		GPRRegs:   pr.GPRRegs,
+		SP:        pr.SP,
+		PC:        pr.PC,
+		FR:        pr.GetFR(),
+		InstCount: pr.InstCount,
+
+		CycleCount: pr.CycleCount,
+		IntVector:  pr.IntVector,
+		IntEnabled: pr.InterruptsEnabled(),
+		IntPending: pr.InterruptPending(),
+	}}
+	copy(s.Profile[:], pr.GetProfile().Name)
+
+	for _, m := range pr.Devices() {
+		d, ok := m.Device.(processor.StatefulDevice)
+		if !ok {
+			return nil, fmt.Errorf("the state of device %v can't be saved", m)
+		}
+		state := append([]uint16{}, d.State()...)
+		s.Devices = append(s.Devices, DeviceState{m.Start, m.End, state})
+	}
+	return s, nil
+}
+
+// ProfileName returns the name of the ISA profile saved, empty for snapshots
+// older than version 4.
+func (s *Snapshot) ProfileName() string {
+	return string(bytes.TrimRight(s.Profile[:], "\x00"))
+}
+
+// Apply replaces the processor state with the one in the snapshot. The
+// processor is reset first, so it's step back journal is discarded. The screen
+// is only given to the processor, drawing it is left to the caller.
+// Snapshots without a profile keep the one of the processor, and devices not
+// in the snapshot are only reset. If the profile is unknown, or a device saved
+// is not mapped to the same range or has an invalid state, nothing is changed
+// and an error is returned.
+func (s *Snapshot) Apply(pr *processor.ICMCProcessor) error {
+	profile := pr.GetProfile()
+	if name := s.ProfileName(); name != "" {
+		var err error
+		if profile, err = processor.ProfileByName(name); err != nil {
+			return err
+		}
+	}
+
+	devices := make([]processor.StatefulDevice, len(s.Devices))
+	for i, ds := range s.Devices {
+		for _, m := range pr.Devices() {
+			if m.Start == ds.Start && m.End == ds.End {
+				devices[i], _ = m.Device.(processor.StatefulDevice)
+			}
+		}
+		if devices[i] == nil {
+			return fmt.Errorf("no device to restore mapped to %.5d..%.5d",
+				ds.Start, ds.End)
+		}
+		if err := devices[i].ValidateState(ds.State); err != nil {
+			return fmt.Errorf("device at %.5d: %v", ds.Start, err)
+		}
+	}
+
+	pr.Code = s.Code
+	pr.Reset()
+	pr.SetProfile(profile)
+
+	for y, row := range s.Screen {
+		for x, c := range row {
+			pr.SetScreenChar(uint16(y*len(row)+x), c)
+		}
+	}
+
+	pr.Data = s.Data
+	pr.GPRRegs = s.GPRRegs
+	pr.SP = s.SP
+	pr.PC = s.PC
+	pr.SetFR(s.FR)
+	pr.InstCount = s.InstCount
+	pr.CycleCount = s.CycleCount
+	pr.IntVector = s.IntVector
+	pr.SetInterruptsEnabled(s.IntEnabled)
+	pr.SetInterruptPending(s.IntPending)
+
+	for i, d := range devices {
+		if err := d.SetState(s.Devices[i].State); err != nil {
+			return fmt.Errorf("device at %.5d: %v", s.Devices[i].Start, err)
+		}
+	}
+	return nil
+}
+
+// Write writes a snapshot in the current format version.
+func Write(w io.Writer, s *Snapshot) error {
+	if err := binary.Write(w, binary.BigEndian, header{magic, Version}); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, &s.Machine); err != nil {
+		return err
+	}
+
+	if len(s.Devices) > 1<<15 {
+		return fmt.Errorf("too many devices to save")
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(len(s.Devices))); err != nil {
+		return err
+	}
+	for _, d := range s.Devices {
+		if len(d.State) > 1<<15 {
+			return fmt.Errorf("state of device at %.5d too big to save", d.Start)
+		}
+		hdr := [3]uint16{d.Start, d.End, uint16(len(d.State))}
+		if err := binary.Write(w, binary.BigEndian, hdr); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, d.State); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDevices reads the device states that end a snapshot.
+func readDevices(r io.Reader) ([]DeviceState, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+
+	devices := make([]DeviceState, n)
+	for i := range devices {
+		var hdr [3]uint16
+		if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+			return nil, err
+		}
+		if hdr[1] < hdr[0] || hdr[1] >= 1<<15 || hdr[2] > 1<<15 {
+			return nil, fmt.Errorf("invalid device at %.5d", hdr[0])
+		}
+
+		devices[i] = DeviceState{hdr[0], hdr[1], make([]uint16, hdr[2])}
+		if err := binary.Read(r, binary.BigEndian, devices[i].State); err != nil {
+			return nil, err
+		}
+	}
+	return devices, nil
+}
+
+// Read reads a snapshot written by Write.
+func Read(r io.Reader) (*Snapshot, error) {
+	var h header
+	if err := binary.Read(r, binary.BigEndian, &h); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %v", err)
+	}
+	if !bytes.Equal(h.Magic[:], magic[:]) {
+		return nil, errors.New("file is not a simulator snapshot")
+	}
+
+	s := &Snapshot{}
+	switch h.Version {
+	case 1:
+		// the cycles were not counted, so they stay zero
+		var old snapshotV1
+		if err := binary.Read(r, binary.BigEndian, &old); err != nil {
+			return nil, fmt.Errorf("invalid snapshot: %v", err)
+		}
+		s = old.snapshot()
+	case 2:
+		// interrupts did not exist, so they stay disabled
+		var old snapshotV2
+		if err := binary.Read(r, binary.BigEndian, &old); err != nil {
+			return nil, fmt.Errorf("invalid snapshot: %v", err)
+		}
+		s = old.snapshot()
+		s.CycleCount = old.CycleCount
+	case 3:
+		// the profile is left empty, so the current one is kept, and the
+		// devices mapped are only reset
+		var old snapshotV3
+		if err := binary.Read(r, binary.BigEndian, &old); err != nil {
+			return nil, fmt.Errorf("invalid snapshot: %v", err)
+		}
+		s = old.snapshot()
+		s.CycleCount = old.CycleCount
+		s.IntVector = old.IntVector
+		s.IntEnabled = old.IntEnabled
+		s.IntPending = old.IntPending
+	case Version:
+		if err := binary.Read(r, binary.BigEndian, &s.Machine); err != nil {
+			return nil, fmt.Errorf("invalid snapshot: %v", err)
+		}
+		devices, err := readDevices(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot: %v", err)
+		}
+		s.Devices = devices
+	default:
+		return nil, fmt.Errorf("unsupported snapshot version %d", h.Version)
+	}
+	return s, nil
+}
@@ -0,0 +1,286 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lucasgpulcinelli/goICMCsim/assembler"
+	"github.com/lucasgpulcinelli/goICMCsim/devices"
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+)
+
+// blank is a screen position never drawn.
+const blank = 16 << 8
+
+// screenHook records the characters drawn by outchar.
+type screenHook map[uint16]uint16
+
+func (s screenHook) outChar(c, pos uint16) error {
+	s[pos] = c
+	return nil
+}
+
+// newProcessor creates a processor with a program loaded and a journal.
+func newProcessor(t *testing.T, src string, screen screenHook) *processor.ICMCProcessor {
+	t.Helper()
+
+	words, err := assembler.Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pr := processor.NewEmptyProcessor(nil, screen.outChar)
+	pr.SetJournalSize(10)
+	copy(pr.Code[:], words)
+	pr.Reset()
+	return pr
+}
+
+func TestRoundTrip(t *testing.T) {
+	const src = `
+		loadn r0, #'A'
+		loadn r1, #5
+		outchar r0, r1
+		store 100, r1
+		outchar r1, r1
+		halt
+	`
+
+	pr := newProcessor(t, src, screenHook{})
+	for i := 0; i < 4; i++ {
+		if err := pr.RunInstruction(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	pr.SetInterruptsEnabled(true)
+	strict, _ := processor.ProfileByName("strict")
+	pr.SetProfile(strict)
+
+	s, err := FromProcessor(pr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for y := range s.Screen {
+		for x := range s.Screen[y] {
+			s.Screen[y][x] = blank
+		}
+	}
+	s.Screen[0][5] = 'A'
+	s.HasCharMap = true
+	s.CharMap[8] = 0xff
+
+	var buf bytes.Buffer
+	if err := Write(&buf, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Machine != s.Machine || len(got.Devices) != 0 {
+		t.Fatalf("snapshot read differs from the one written")
+	}
+
+	screen := screenHook{}
+	restored := newProcessor(t, "halt", screen)
+	if err := got.Apply(restored); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if restored.Code != pr.Code || restored.Data != pr.Data ||
+		restored.GPRRegs != pr.GPRRegs || restored.SP != pr.SP ||
+		restored.PC != pr.PC || restored.GetFR() != pr.GetFR() ||
+		restored.InstCount != pr.InstCount ||
+		restored.CycleCount != pr.CycleCount || !restored.InterruptsEnabled() ||
+		restored.GetProfile().Name != "strict" {
+		t.Errorf("processor state not restored")
+	}
+
+	// the character drawn before the snapshot is drawn again when the outchar
+	// after it is stepped back
+	if err := restored.RunInstruction(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if screen[5] != 5 {
+		t.Fatalf("outchar drew %d, want 5", screen[5])
+	}
+	if err := restored.StepBack(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if screen[5] != 'A' {
+		t.Errorf("step back drew %d, want the %d in the snapshot", screen[5], 'A')
+	}
+}
+
+// writeOld writes a snapshot file of an old version field by field, in the
+// layout that version had: CycleCount was added in version 2, and the
+// interrupt state in version 3.
+func writeOld(t *testing.T, version uint16, s *Snapshot) *bytes.Buffer {
+	t.Helper()
+
+	fields := []interface{}{
+		magic, version,
+		s.Code, s.Data, s.GPRRegs, s.SP, s.PC, s.FR, s.InstCount,
+		s.Screen, s.HasCharMap, s.CharMap,
+	}
+	if version >= 2 {
+		fields = append(fields, s.CycleCount)
+	}
+	if version >= 3 {
+		fields = append(fields, s.IntVector, s.IntEnabled, s.IntPending)
+	}
+
+	var buf bytes.Buffer
+	for _, f := range fields {
+		if err := binary.Write(&buf, binary.BigEndian, f); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return &buf
+}
+
+func TestReadOldVersions(t *testing.T) {
+	s := &Snapshot{Machine: Machine{
+		GPRRegs:    [8]uint16{1, 2, 3, 4, 5, 6, 7, 8},
+		SP:         1000,
+		PC:         20,
+		FR:         0b101,
+		InstCount:  30,
+		HasCharMap: true,
+		CycleCount: 90,
+		IntVector:  40,
+		IntEnabled: true,
+	}}
+	s.Code[0] = 0xabcd
+	s.Data[1<<15-1] = 0x1234
+	s.Screen[29][39] = 'z'
+	s.CharMap[1023] = 0x81
+
+	for _, version := range []uint16{1, 2, 3} {
+		got, err := Read(writeOld(t, version, s))
+		if err != nil {
+			t.Fatalf("version %d: unexpected error: %v", version, err)
+		}
+
+		want := s.Machine
+		if version < 3 {
+			want.IntVector, want.IntEnabled = 0, false
+		}
+		if version < 2 {
+			want.CycleCount = 0
+		}
+		if got.Machine != want || got.Devices != nil {
+			t.Errorf("version %d snapshot not read as written", version)
+		}
+	}
+
+	if _, err := Read(writeOld(t, Version+1, s)); err == nil {
+		t.Errorf("unknown version read without an error")
+	}
+	if _, err := Read(strings.NewReader("ICMCSNAX\x00\x01")); err == nil {
+		t.Errorf("invalid magic read without an error")
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	pr := newProcessor(t, "halt", screenHook{})
+	vhdl, _ := processor.ProfileByName("vhdl")
+	pr.SetProfile(vhdl)
+
+	// old snapshots have no profile, and keep the current one
+	s, err := FromProcessor(pr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.Profile = [32]byte{}
+	if err := s.Apply(pr); err != nil || pr.GetProfile().Name != "vhdl" {
+		t.Errorf("profile %s after applying a snapshot without one (%v)",
+			pr.GetProfile().Name, err)
+	}
+
+	// including the ones read from files written before profiles were saved
+	copy(s.Profile[:], "strict")
+	old, err := Read(writeOld(t, 3, s))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := old.Apply(pr); err != nil || pr.GetProfile().Name != "vhdl" {
+		t.Errorf("profile %s after applying a version 3 snapshot (%v)",
+			pr.GetProfile().Name, err)
+	}
+
+	copy(s.Profile[:], "unknown")
+	s.PC = 10
+	if err := s.Apply(pr); err == nil || pr.PC == 10 {
+		t.Errorf("snapshot with an unknown profile applied")
+	}
+}
+
+// nullDevice is a device without any state to save.
+type nullDevice struct{}
+
+func (nullDevice) Read(offset uint16) (uint16, error) { return 0, nil }
+func (nullDevice) Write(offset, v uint16) error       { return nil }
+func (nullDevice) Reset()                             {}
+
+func TestDevices(t *testing.T) {
+	pr := newProcessor(t, "halt", screenHook{})
+	timer, err := devices.MapTimer(pr, 1000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	timer.Write(devices.TimerControl, devices.TimerEnable)
+	timer.Write(devices.TimerPeriod, 10)
+	timer.Write(devices.TimerCount, 7)
+	timer.Write(devices.TimerFired, 2)
+
+	s, err := FromProcessor(pr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s, err = Read(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []DeviceState{{1000, 1003, []uint16{devices.TimerEnable, 10, 7, 2}}}
+	if !reflect.DeepEqual(s.Devices, want) {
+		t.Fatalf("devices read as %v, want %v", s.Devices, want)
+	}
+
+	// the timer is restored after the reset done by Apply
+	if err := s.Apply(pr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(timer.State(), want[0].State) {
+		t.Errorf("timer restored as %v, want %v", timer.State(), want[0].State)
+	}
+
+	// an invalid state is found before anything is changed
+	s.Devices[0].State = []uint16{1 << 2, 0, 0, 0}
+	s.PC = 10
+	if err := s.Apply(pr); err == nil || pr.PC == 10 ||
+		!reflect.DeepEqual(timer.State(), want[0].State) {
+		t.Errorf("snapshot applied with an invalid timer state")
+	}
+	s.Devices[0].State = want[0].State
+
+	// a device saved must be mapped to the same range
+	pr.UnmapDevice(1000)
+	devices.MapTimer(pr, 1001)
+	s.PC = 10
+	if err := s.Apply(pr); err == nil || pr.PC == 10 {
+		t.Errorf("snapshot applied without the timer mapped")
+	}
+
+	// and devices without a state can't be saved
+	pr.MapDevice(2000, 2000, nullDevice{})
+	if _, err := FromProcessor(pr); err == nil {
+		t.Errorf("device without a state saved")
+	}
+}
@@ -0,0 +1,184 @@
+// package trace implements writers for execution traces of the ICMC
+// processor, in JSON Lines or in a compact binary format.
+//
+// The binary format starts with the 8 byte magic "ICMCTRC\x00" and a big
+// endian uint16 version, followed by one fixed size record per instruction:
+// PC, instruction, operand, the 8 registers, SP, old FR and FR (all big endian
+// uint16), the kind of record (processor.TraceKind), a flags byte (bit 0 set
+// if memory was written, bit 1 if a second word was, as taking an interrupt
+// does), and the address and value of each write (uint16 each). Version 1
+// records had no kind and a single write, with 33 bytes.
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+)
+
+// BinaryVersion is the current version of the binary trace format.
+const BinaryVersion = 2
+
+// binaryRecordSize is the size in bytes of a single binary record.
+const binaryRecordSize = 2*14 + 2 + 2*4
+
+var binaryMagic = []byte("ICMCTRC\x00")
+
+// Writer is a processor.Tracer that writes records to a file, and must be
+// closed after the processor stops to flush all records.
+type Writer interface {
+	processor.Tracer
+	Close() error
+}
+
+// NewWriter creates a trace writer in a format ("json" or "binary"). At most
+// limit instructions are written (zero means no limit), the ones after that
+// are silently ignored.
+func NewWriter(w io.WriteCloser, format string, limit uint64) (Writer, error) {
+	switch format {
+	case "json":
+		return NewJSONWriter(w, limit), nil
+	case "binary":
+		return NewBinaryWriter(w, limit)
+	}
+	return nil, fmt.Errorf("invalid trace format %s", format)
+}
+
+// base implements the buffering and instruction limit common to all writers.
+type base struct {
+	file  io.WriteCloser
+	buf   *bufio.Writer
+	limit uint64
+	count uint64
+}
+
+// full returns if no more records can be written, counting the one about to
+// be written.
+func (b *base) full() bool {
+	if b.limit != 0 && b.count >= b.limit {
+		return true
+	}
+	b.count++
+	return false
+}
+
+func (b *base) Close() error {
+	if err := b.buf.Flush(); err != nil {
+		b.file.Close()
+		return err
+	}
+	return b.file.Close()
+}
+
+// jsonRecord is the representation of a single instruction in JSON Lines.
+type jsonRecord struct {
+	PC        uint16    `json:"pc"`
+	Inst      uint16    `json:"inst"`
+	Operand   *uint16   `json:"operand,omitempty"`
+	Mnemonic  string    `json:"mnemonic"`
+	Regs      [8]uint16 `json:"regs"`
+	SP        uint16    `json:"sp"`
+	FR        uint16    `json:"fr"`
+	FRChange  uint16    `json:"fr_changed,omitempty"` // the bits that changed
+	MemAddr   *uint16   `json:"mem_addr,omitempty"`
+	MemValue  *uint16   `json:"mem_value,omitempty"`
+	MemAddr2  *uint16   `json:"mem_addr2,omitempty"` // the second write
+	MemValue2 *uint16   `json:"mem_value2,omitempty"`
+}
+
+// JSONWriter writes one JSON object per instruction, with it's mnemonic.
+// Edits have the mnemonic "edit" and interrupts "int".
+type JSONWriter struct {
+	base
+	enc *json.Encoder
+}
+
+func NewJSONWriter(w io.WriteCloser, limit uint64) *JSONWriter {
+	buf := bufio.NewWriter(w)
+	return &JSONWriter{base{file: w, buf: buf, limit: limit}, json.NewEncoder(buf)}
+}
+
+func (w *JSONWriter) Trace(r *processor.TraceRecord) error {
+	if w.full() {
+		return nil
+	}
+
+	rec := jsonRecord{
+		PC:       r.PC,
+		Inst:     r.Inst,
+		Mnemonic: r.Mnemonic(),
+		Regs:     r.Regs,
+		SP:       r.SP,
+		FR:       r.FR,
+		FRChange: r.FR ^ r.OldFR,
+	}
+	if r.Size == 2 {
+		rec.Operand = &r.Operand
+	}
+	if r.MemWrites > 0 {
+		rec.MemAddr = &r.MemAddr[0]
+		rec.MemValue = &r.MemValue[0]
+	}
+	if r.MemWrites > 1 {
+		rec.MemAddr2 = &r.MemAddr[1]
+		rec.MemValue2 = &r.MemValue[1]
+	}
+
+	return w.enc.Encode(rec)
+}
+
+// BinaryWriter writes fixed size binary records, as described in the package
+// documentation.
+type BinaryWriter struct {
+	base
+	rec [binaryRecordSize]byte
+}
+
+func NewBinaryWriter(w io.WriteCloser, limit uint64) (*BinaryWriter, error) {
+	buf := bufio.NewWriter(w)
+
+	if _, err := buf.Write(binaryMagic); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.BigEndian, uint16(BinaryVersion)); err != nil {
+		return nil, err
+	}
+
+	return &BinaryWriter{base: base{file: w, buf: buf, limit: limit}}, nil
+}
+
+func (w *BinaryWriter) Trace(r *processor.TraceRecord) error {
+	if w.full() {
+		return nil
+	}
+
+	b := w.rec[:0]
+	b = binary.BigEndian.AppendUint16(b, r.PC)
+	b = binary.BigEndian.AppendUint16(b, r.Inst)
+	b = binary.BigEndian.AppendUint16(b, r.Operand)
+	for _, reg := range r.Regs {
+		b = binary.BigEndian.AppendUint16(b, reg)
+	}
+	b = binary.BigEndian.AppendUint16(b, r.SP)
+	b = binary.BigEndian.AppendUint16(b, r.OldFR)
+	b = binary.BigEndian.AppendUint16(b, r.FR)
+
+	b = append(b, byte(r.Kind))
+
+	flags := byte(0)
+	for i := byte(0); i < r.MemWrites; i++ {
+		flags |= 1 << i
+	}
+	b = append(b, flags)
+	for i := range r.MemAddr {
+		b = binary.BigEndian.AppendUint16(b, r.MemAddr[i])
+		b = binary.BigEndian.AppendUint16(b, r.MemValue[i])
+	}
+
+	_, err := w.buf.Write(b)
+	return err
+}
@@ -0,0 +1,238 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasgpulcinelli/goICMCsim/assembler"
+	"github.com/lucasgpulcinelli/goICMCsim/processor"
+)
+
+// traceProgram runs 5 instructions, writing to memory and changing flags.
+const traceProgram = `
+	loadn r0, #3
+	loadn r1, #3
+	cmp r0, r1
+	store 100, r1
+	halt
+`
+
+// buffer is a WriteCloser keeping everything written in memory.
+type buffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *buffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+// runTraced runs traceProgram with a trace in a format, followed by an edit,
+// returning what was written.
+func runTraced(t *testing.T, format string, limit uint64) *buffer {
+	t.Helper()
+
+	words, err := assembler.Assemble(strings.NewReader(traceProgram))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pr := processor.NewEmptyProcessor(nil, nil)
+	copy(pr.Code[:], words)
+	pr.Reset()
+
+	out := &buffer{}
+	tw, err := NewWriter(out, format, limit)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pr.SetTracer(tw)
+
+	var period time.Duration
+	if err := pr.RunUntilHalt(&period); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pr.WriteMemory(200, 9); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tw.Close(); err != nil || !out.closed {
+		t.Fatalf("trace not closed: %v", err)
+	}
+	return out
+}
+
+// readJSON decodes every record of a JSON Lines trace.
+func readJSON(t *testing.T, r io.Reader) []jsonRecord {
+	t.Helper()
+
+	var recs []jsonRecord
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		var rec jsonRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid line %q: %v", sc.Text(), err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+// binaryRecord is the decoded form of a binary record.
+type binaryRecord struct {
+	PC, Inst, Operand uint16
+	Regs              [8]uint16
+	SP, OldFR, FR     uint16
+	Kind, Flags       byte
+	MemAddr, MemValue uint16
+	MemAddr2          uint16
+	MemValue2         uint16
+}
+
+// readBinary decodes every record of a binary trace, checking it's header.
+func readBinary(t *testing.T, b []byte) []binaryRecord {
+	t.Helper()
+
+	if !bytes.HasPrefix(b, binaryMagic) {
+		t.Fatalf("binary trace starts with %q", b[:8])
+	}
+	if v := binary.BigEndian.Uint16(b[8:]); v != BinaryVersion {
+		t.Fatalf("binary trace version %d, want %d", v, BinaryVersion)
+	}
+
+	b = b[10:]
+	if len(b)%binaryRecordSize != 0 {
+		t.Fatalf("%d bytes of records, not a multiple of %d", len(b),
+			binaryRecordSize)
+	}
+
+	recs := make([]binaryRecord, len(b)/binaryRecordSize)
+	if err := binary.Read(bytes.NewReader(b), binary.BigEndian, recs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return recs
+}
+
+func TestJSON(t *testing.T) {
+	recs := readJSON(t, runTraced(t, "json", 0))
+
+	mnemonics := []string{"loadn R0", "loadn R1", "cmp R0, R1", "store R1", "halt", "edit"}
+	if len(recs) != len(mnemonics) {
+		t.Fatalf("%d records, want %d", len(recs), len(mnemonics))
+	}
+	for i, m := range mnemonics {
+		if strings.TrimSpace(recs[i].Mnemonic) != m {
+			t.Errorf("record %d is %q, want %q", i, recs[i].Mnemonic, m)
+		}
+	}
+
+	if recs[0].PC != 0 || recs[0].Operand == nil || *recs[0].Operand != 3 ||
+		recs[0].Regs[0] != 3 {
+		t.Errorf("loadn traced as %+v", recs[0])
+	}
+	if recs[2].Operand != nil || recs[2].FRChange == 0 {
+		t.Errorf("cmp traced as %+v", recs[2])
+	}
+	if recs[3].MemAddr == nil || *recs[3].MemAddr != 100 || *recs[3].MemValue != 3 {
+		t.Errorf("store traced as %+v", recs[3])
+	}
+	if recs[5].MemAddr == nil || *recs[5].MemAddr != 200 || *recs[5].MemValue != 9 {
+		t.Errorf("edit traced as %+v", recs[5])
+	}
+}
+
+func TestBinary(t *testing.T) {
+	recs := readBinary(t, runTraced(t, "binary", 0).Bytes())
+	if len(recs) != 6 {
+		t.Fatalf("%d records, want 6", len(recs))
+	}
+
+	pcs := []uint16{0, 2, 4, 5, 7, 7}
+	for i, pc := range pcs {
+		if recs[i].PC != pc {
+			t.Errorf("record %d at PC %d, want %d", i, recs[i].PC, pc)
+		}
+	}
+
+	if recs[1].Operand != 3 || recs[1].Regs[1] != 3 || recs[1].Flags != 0 {
+		t.Errorf("loadn traced as %+v", recs[1])
+	}
+	if recs[2].OldFR == recs[2].FR {
+		t.Errorf("cmp traced without flag changes")
+	}
+	if recs[3].Flags != 1 || recs[3].MemAddr != 100 || recs[3].MemValue != 3 {
+		t.Errorf("store traced as %+v", recs[3])
+	}
+	edit := recs[5]
+	if processor.TraceKind(edit.Kind) != processor.TraceEdit || edit.Flags != 1 ||
+		edit.MemAddr != 200 || edit.MemValue != 9 {
+		t.Errorf("edit traced as %+v", edit)
+	}
+	for _, r := range recs[:5] {
+		if processor.TraceKind(r.Kind) != processor.TraceInst {
+			t.Errorf("instruction at %d traced with kind %d", r.PC, r.Kind)
+		}
+	}
+}
+
+func TestLimit(t *testing.T) {
+	if recs := readJSON(t, runTraced(t, "json", 2)); len(recs) != 2 ||
+		recs[1].PC != 2 {
+		t.Errorf("json trace limited to 2 has %d records", len(recs))
+	}
+	if recs := readBinary(t, runTraced(t, "binary", 2).Bytes()); len(recs) != 2 ||
+		recs[1].PC != 2 {
+		t.Errorf("binary trace limited to 2 has %d records", len(recs))
+	}
+
+	if _, err := NewWriter(&buffer{}, "xml", 0); err == nil {
+		t.Errorf("invalid format accepted")
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	words, err := assembler.Assemble(strings.NewReader("ei\nnop\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, format := range []string{"json", "binary"} {
+		pr := processor.NewEmptyProcessor(nil, nil)
+		copy(pr.Code[:], words)
+		pr.Reset()
+
+		out := &buffer{}
+		tw, _ := NewWriter(out, format, 0)
+		pr.SetTracer(tw)
+		pr.RunInstruction()
+		pr.SetInterruptPending(true)
+		if err := pr.RunInstruction(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		tw.Close()
+
+		// the PC and then the flag register are pushed
+		const top = (1 << 15) - 1
+		if format == "json" {
+			rec := readJSON(t, out)[1]
+			if rec.Mnemonic != "int" || rec.PC != 1 || rec.MemAddr == nil ||
+				*rec.MemAddr != top || *rec.MemValue != 1 || rec.MemAddr2 == nil ||
+				*rec.MemAddr2 != top-1 {
+				t.Errorf("interrupt traced as %+v", rec)
+			}
+			continue
+		}
+
+		rec := readBinary(t, out.Bytes())[1]
+		if processor.TraceKind(rec.Kind) != processor.TraceInterrupt ||
+			rec.Flags != 0b11 || rec.MemAddr != top || rec.MemValue != 1 ||
+			rec.MemAddr2 != top-1 {
+			t.Errorf("interrupt traced as %+v", rec)
+		}
+	}
+}